@@ -3,71 +3,193 @@ package main
 import (
   cmdline  "github.com/galdor/go-cmdline"
   context  "context"
+  fmt      "fmt"
   internal "github.com/gpenaud/needys-api-resource/internal"
   log      "github.com/sirupsen/logrus"
   os       "os"
   signal   "os/signal"
+  strconv  "strconv"
   syscall  "syscall"
 )
 
+// command holds the optional command and its arguments, "serve" by default
+var command []string
+
+// configuration precedence is: defaults < configuration file < environment
+// variables < flags
 func registerCliConfiguration(a *internal.Application) {
   cmdline := cmdline.New()
 
-  a.Config = &internal.Configuration{}
+  defaults := internal.DefaultConfiguration()
+
+  cmdline.AddOption("c", "config", "FILE", "YAML configuration file")
 
   // application configuration flags
   cmdline.AddOption("e", "environment", "ENVIRONMENT", "the current environment (development, integration, production)")
-  cmdline.SetOptionDefault("environment", "production")
+  cmdline.SetOptionDefault("environment", defaults.Environment)
 
   cmdline.AddOption("v", "verbosity", "LEVEL", "verbosity for log-level (error, warning, info, debug)")
-  cmdline.SetOptionDefault("verbosity", "info")
+  cmdline.SetOptionDefault("verbosity", defaults.Verbosity)
 
   cmdline.AddOption("l", "log-format", "FORMAT", "log format (text, json)")
-  cmdline.SetOptionDefault("log-format", "unset")
+  cmdline.SetOptionDefault("log-format", defaults.LogFormat)
 
   cmdline.AddFlag("", "log-healthcheck", "log healthcheck queries")
 
   // application server configuration flags
   cmdline.AddOption("", "server.host", "HOST", "host of application")
-  cmdline.SetOptionDefault("server.host", "localhost")
+  cmdline.SetOptionDefault("server.host", defaults.Server.Host)
 
   cmdline.AddOption("", "server.port", "PORT", "port of application")
-  cmdline.SetOptionDefault("server.port", "8012")
+  cmdline.SetOptionDefault("server.port", defaults.Server.Port)
 
   // db configuration flags
   cmdline.AddOption("", "database.host", "HOST", "host of database")
-  cmdline.SetOptionDefault("database.host", "localhost")
+  cmdline.SetOptionDefault("database.host", defaults.Database.Host)
 
   cmdline.AddOption("", "database.port", "PORT", "port of database")
-  cmdline.SetOptionDefault("database.port", "5432")
+  cmdline.SetOptionDefault("database.port", defaults.Database.Port)
 
   cmdline.AddOption("", "database.name", "NAME", "name of database")
-  cmdline.SetOptionDefault("database.name", "postgres")
+  cmdline.SetOptionDefault("database.name", defaults.Database.Name)
 
   cmdline.AddOption("", "database.username", "USERNAME", "username for database user")
-  cmdline.SetOptionDefault("database.username", "postgres")
+  cmdline.SetOptionDefault("database.username", defaults.Database.Username)
 
   cmdline.AddOption("", "database.password", "PASSWORD", "password for the database user")
-  cmdline.SetOptionDefault("database.password", "postgres")
+  cmdline.SetOptionDefault("database.password", defaults.Database.Password)
+
+  cmdline.AddOption("", "database.password-file", "FILE", "file containing the password for the database user, read again on SIGHUP")
+
+  cmdline.AddOption("", "database.sslmode", "MODE", "SSL mode (disable, require, verify-ca, verify-full)")
+  cmdline.SetOptionDefault("database.sslmode", defaults.Database.SSLMode)
+
+  cmdline.AddOption("", "database.sslrootcert", "FILE", "root certificate authority used to verify the database server")
+  cmdline.AddOption("", "database.sslcert", "FILE", "client certificate for the database")
+  cmdline.AddOption("", "database.sslkey", "FILE", "client certificate key for the database")
+
+  cmdline.AddOption("", "database.connect-timeout", "SECONDS", "timeout of a database connection, 0 waits indefinitely")
+  cmdline.SetOptionDefault("database.connect-timeout", strconv.Itoa(defaults.Database.ConnectTimeout))
+
+  cmdline.AddOption("", "database.application-name", "NAME", "application name reported to the database")
+  cmdline.SetOptionDefault("database.application-name", defaults.Database.ApplicationName)
+
+  cmdline.AddOption("", "database.search-path", "SCHEMAS", "schema search path of database sessions")
+
+  cmdline.AddOption("", "database.wait-timeout", "SECONDS", "how long to wait for the database at startup")
+  cmdline.SetOptionDefault("database.wait-timeout", strconv.Itoa(defaults.Database.WaitTimeout))
+
+  cmdline.AddFlag("", "database.allow-degraded-start", "start, while not ready, if the database is still unreachable after the wait timeout")
+
+  cmdline.AddOption("", "database.pool.max-idle-conns", "COUNT", "maximum number of idle database connections")
+  cmdline.SetOptionDefault("database.pool.max-idle-conns", strconv.Itoa(defaults.Database.Pool.MaxIdleConns))
+
+  cmdline.AddOption("", "database.pool.max-open-conns", "COUNT", "maximum number of open database connections, 0 is unlimited")
+  cmdline.SetOptionDefault("database.pool.max-open-conns", strconv.Itoa(defaults.Database.Pool.MaxOpenConns))
+
+  cmdline.AddOption("", "database.pool.conn-max-lifetime", "SECONDS", "maximum lifetime of a database connection, 0 is unlimited")
+  cmdline.SetOptionDefault("database.pool.conn-max-lifetime", strconv.Itoa(defaults.Database.Pool.ConnMaxLifetime))
+
+  cmdline.AddOption("", "database.pool.conn-max-idle-time", "SECONDS", "maximum idle time of a database connection, 0 is unlimited")
+  cmdline.SetOptionDefault("database.pool.conn-max-idle-time", strconv.Itoa(defaults.Database.Pool.ConnMaxIdleTime))
+
+  // amqp configuration flags
+  cmdline.AddFlag("", "amqp.enabled", "relay the resource lifecycle events of the outbox to the message broker")
+
+  cmdline.AddOption("", "amqp.host", "HOST", "host of the message broker")
+  cmdline.SetOptionDefault("amqp.host", defaults.Amqp.Host)
+
+  cmdline.AddOption("", "amqp.port", "PORT", "port of the message broker")
+  cmdline.SetOptionDefault("amqp.port", defaults.Amqp.Port)
+
+  cmdline.AddOption("", "amqp.username", "USERNAME", "username for the message broker user")
+  cmdline.SetOptionDefault("amqp.username", defaults.Amqp.Username)
+
+  cmdline.AddOption("", "amqp.password", "PASSWORD", "password for the message broker user")
+  cmdline.SetOptionDefault("amqp.password", defaults.Amqp.Password)
+
+  cmdline.AddOption("", "amqp.virtual-host", "VHOST", "virtual host of the message broker")
+  cmdline.SetOptionDefault("amqp.virtual-host", defaults.Amqp.VirtualHost)
+
+  cmdline.AddOption("", "amqp.exchange", "NAME", "topic exchange the events are published to")
+  cmdline.SetOptionDefault("amqp.exchange", defaults.Amqp.Exchange)
+
+  cmdline.AddOption("", "amqp.timeout", "SECONDS", "timeout of the connection and of the confirmation of an event")
+  cmdline.SetOptionDefault("amqp.timeout", strconv.Itoa(defaults.Amqp.Timeout))
+
+  // outbox configuration flags
+  cmdline.AddOption("", "outbox.poll-interval", "SECONDS", "interval between two polls of the outbox of events")
+  cmdline.SetOptionDefault("outbox.poll-interval", strconv.Itoa(defaults.Outbox.PollInterval))
+
+  cmdline.AddOption("", "outbox.retention-hours", "HOURS", "hours delivered events stay in the outbox, 0 keeps them")
+  cmdline.SetOptionDefault("outbox.retention-hours", strconv.Itoa(defaults.Outbox.RetentionHours))
+
+  // healthcheck configuration flags
+  cmdline.AddOption("", "healthcheck.timeout", "SECONDS", "timeout of the readiness probe")
+  cmdline.SetOptionDefault("healthcheck.timeout", strconv.Itoa(defaults.Healthcheck.Timeout))
+
+  // pagination configuration flags
+  cmdline.AddOption("", "pagination.default-page-size", "SIZE", "number of resources in a page when no limit is given")
+  cmdline.SetOptionDefault("pagination.default-page-size", strconv.Itoa(defaults.Pagination.DefaultPageSize))
+
+  cmdline.AddOption("", "pagination.max-page-size", "SIZE", "maximum number of resources in a page")
+  cmdline.SetOptionDefault("pagination.max-page-size", strconv.Itoa(defaults.Pagination.MaxPageSize))
+
+  // maintenance configuration flags
+  cmdline.AddOption("", "maintenance.token", "TOKEN", "admin token required by maintenance routes, which are disabled when empty")
+
+  // concurrency configuration flags
+  cmdline.AddFlag("", "concurrency.require-if-match", "reject the changes of resources sent without an If-Match header")
+
+  // trash configuration flags
+  cmdline.AddOption("", "trash.retention-days", "DAYS", "days a deleted resource stays in the trash before being purged, 0 keeps it")
+  cmdline.SetOptionDefault("trash.retention-days", strconv.Itoa(defaults.Trash.RetentionDays))
+
+  cmdline.AddOption("", "trash.purge-interval", "SECONDS", "interval between two purges of the trash")
+  cmdline.SetOptionDefault("trash.purge-interval", strconv.Itoa(defaults.Trash.PurgeInterval))
+
+  // need service configuration flags
+  cmdline.AddOption("", "need.url", "URL", "base URL of the need service checking the needs of resources, which are not checked when empty")
+
+  cmdline.AddOption("", "need.timeout", "SECONDS", "timeout of the requests to the need service")
+  cmdline.SetOptionDefault("need.timeout", strconv.Itoa(defaults.Need.Timeout))
+
+  cmdline.AddTrailingArguments("command", "serve (default), migrate up [VERSION] | down [STEPS] | status | verify, or config print | validate")
 
   cmdline.Parse(os.Args)
 
-  // application general configuration
-  a.Config.Environment    = cmdline.OptionValue("environment")
-  a.Config.Verbosity      = cmdline.OptionValue("verbosity")
-  a.Config.LogFormat      = cmdline.OptionValue("log-format")
-  a.Config.LogHealthcheck = cmdline.IsOptionSet("log-healthcheck")
-
-  // a server configuration values
-  a.Config.Server.Host = cmdline.OptionValue("server.host")
-  a.Config.Server.Port = cmdline.OptionValue("server.port")
-
-  // database configuration value
-  a.Config.Database.Host     = cmdline.OptionValue("database.host")
-  a.Config.Database.Port     = cmdline.OptionValue("database.port")
-  a.Config.Database.Name     = cmdline.OptionValue("database.name")
-  a.Config.Database.Username = cmdline.OptionValue("database.username")
-  a.Config.Database.Password = cmdline.OptionValue("database.password")
+  command = cmdline.TrailingArgumentsValues("command")
+
+  path := ""
+
+  if cmdline.IsOptionSet("config") {
+    path = cmdline.OptionValue("config")
+  }
+
+  // only the flags explicitly set override the file and environment values;
+  // they are named after the YAML keys, and the ones without value are set
+  // booleans
+  flags := map[string]string{}
+
+  for _, key := range internal.ConfigurationKeys() {
+    option, found := cmdline.Options[internal.FlagName(key)]
+    if !found || !option.Set {
+      continue
+    }
+
+    if option.ValueString == "" {
+      flags[key] = "true"
+    } else {
+      flags[key] = option.Value
+    }
+  }
+
+  config, err := internal.LoadConfiguration(path, os.LookupEnv, flags)
+  if err != nil {
+    cmdline.Die("%s", err)
+  }
+
+  a.Config = config
 }
 
 var BuildTime = "unset"
@@ -75,7 +197,7 @@ var Commit 		= "unset"
 var Release 	= "unset"
 
 func registerVersion(a *internal.Application) {
-  a.Version = &internal.Version{BuildTime, Commit, Release}
+  a.Version = &internal.Version{BuildTime: BuildTime, Commit: Commit, Release: Release}
 }
 
 var mainLog *log.Entry
@@ -89,11 +211,67 @@ func init() {
 
   registerCliConfiguration(&a)
   registerVersion(&a)
-
-  a.Initialize()
 }
 
 func main() {
+  if len(command) == 0 {
+    command = []string{"serve"}
+  }
+
+  // config commands also work on an invalid configuration
+  if command[0] == "config" {
+    configCommand(command[1:])
+    return
+  }
+
+  if err := a.Config.Validate(); err != nil {
+    fmt.Fprintf(os.Stderr, "error: %s\n", err)
+    os.Exit(1)
+  }
+
+  switch command[0] {
+  case "serve":
+    serve()
+  case "migrate":
+    if err := a.Migrate(command[1:]); err != nil {
+      mainLog.WithFields(log.Fields{
+        "error": err,
+      }).Fatal("migrate command failed")
+    }
+  default:
+    mainLog.WithFields(log.Fields{
+      "command": command[0],
+    }).Fatal("unknown command")
+  }
+}
+
+func configCommand(args []string) {
+  if len(args) != 1 {
+    fmt.Fprintln(os.Stderr, "usage: config print | validate")
+    os.Exit(1)
+  }
+
+  switch args[0] {
+  case "print":
+    if err := a.Config.Print(os.Stdout); err != nil {
+      fmt.Fprintf(os.Stderr, "error: %s\n", err)
+      os.Exit(1)
+    }
+  case "validate":
+    if err := a.Config.Validate(); err != nil {
+      fmt.Fprintf(os.Stderr, "error: %s\n", err)
+      os.Exit(1)
+    }
+    fmt.Println("configuration is valid")
+  default:
+    fmt.Fprintf(os.Stderr, "unknown config command %q, usage: config print | validate\n", args[0])
+    os.Exit(1)
+  }
+}
+
+func serve() {
+  a.Initialize()
+
   c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
@@ -109,5 +287,20 @@ func main() {
 		cancel()
 	}()
 
+  hup := make(chan os.Signal, 1)
+  signal.Notify(hup, syscall.SIGHUP)
+
+  go func() {
+    for range hup {
+      mainLog.Warn("received SIGHUP, reloading the database password")
+
+      if err := a.ReloadDatabasePassword(); err != nil {
+        mainLog.WithFields(log.Fields{
+          "error": err,
+        }).Error("cannot reload the database password")
+      }
+    }
+  }()
+
   a.Run(ctx)
 }
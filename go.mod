@@ -1,12 +1,11 @@
 module github.com/gpenaud/needys-api-resource
 
-go 1.14
+go 1.15
 
 require (
 	github.com/cucumber/godog v0.11.0
 	github.com/galdor/go-cmdline v1.1.1
 	github.com/gorilla/mux v1.8.0
-	github.com/gpenaud/needys-api-need v0.0.0-20210613202029-3c99583f8379
 	github.com/lib/pq v1.10.2
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/pflag v1.0.5
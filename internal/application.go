@@ -1,14 +1,16 @@
 package internal
 
 import (
-  context "context"
-  fmt  "fmt"
-  http "net/http"
-  log  "github.com/sirupsen/logrus"
-  _    "github.com/lib/pq"
-  mux  "github.com/gorilla/mux"
-  sql  "database/sql"
-  time "time"
+  context  "context"
+  event    "github.com/gpenaud/needys-api-resource/internal/event"
+  fmt      "fmt"
+  http     "net/http"
+  log      "github.com/sirupsen/logrus"
+  mux      "github.com/gorilla/mux"
+  need     "github.com/gpenaud/needys-api-resource/internal/need"
+  resource "github.com/gpenaud/needys-api-resource/internal/resource"
+  sync     "sync"
+  time     "time"
 )
 
 var applicationLog *log.Entry
@@ -20,27 +22,6 @@ func init() {
   })
 }
 
-type Configuration struct {
-  Environment    string
-  Verbosity      string
-  LogFormat      string
-  LogHealthcheck bool
-  Server struct {
-    Host string
-    Port string
-  }
-  Database struct {
-    Host     string
-    Port     string
-    Name     string
-    Username string
-    Password string
-  }
-  Healthcheck struct {
-    Timeout  int
-  }
-}
-
 type Version struct {
   BuildTime string
   Commit    string
@@ -49,52 +30,49 @@ type Version struct {
 
 type Application struct {
   Router  *mux.Router
-  DB      *sql.DB
+  Store   resource.ResourceStore
+  // Needs checks the needs linked to resources, which are not checked when nil
+  Needs   need.Client
+  // Events publishes the resource lifecycle events of the outbox, which
+  // stay there when nil
+  Events  event.Publisher
   Config  *Configuration
   Version *Version
+  // protects the database password, which may be reloaded at runtime
+  passwordMutex sync.RWMutex
 }
 
 func (a *Application) isDatabaseReachable() (err error) {
-  _, err = a.DB.Query("SELECT null")
-  return err
+  timeout := time.Duration(a.Config.Healthcheck.Timeout) * time.Second
+
+  ctx, cancel := context.WithTimeout(context.Background(), timeout)
+  defer cancel()
+
+  return a.Store.Ping(ctx)
 }
 
 func (a *Application) Initialize() {
-  connectionString :=
-    fmt.Sprintf(
-      "host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-      a.Config.Database.Host,
-      a.Config.Database.Port,
-      a.Config.Database.Username,
-      a.Config.Database.Password,
-      a.Config.Database.Name,
-    )
-
-  var err error
+  // a store may have been injected beforehand, e.g. an in-memory one
+  a.initializeLogger()
 
-  if a.DB, err = sql.Open("postgres", connectionString); err != nil {
-    applicationLog.Error(err)
+  if a.Store == nil {
+    a.initializeDatabase()
   }
 
-  a.DB.SetMaxIdleConns(3)
-  a.DB.SetMaxOpenConns(10)
-  a.DB.SetConnMaxLifetime(3600 * time.Second)
-
-  applicationLog.WithFields(log.Fields{
-    "database_host": a.Config.Database.Host,
-    "database_port": a.Config.Database.Port,
-    "database_username": a.Config.Database.Username,
-    "database_name":   a.Config.Database.Name,
-  }).Info("trying to connect to database")
+  a.initializeNeeds()
+  a.initializeEvents()
 
   a.Router = mux.NewRouter()
-
-  a.initializeLogger()
+  a.Router.Use(correlate)
+  // the middlewares do not wrap the handlers of unmatched requests
+  a.Router.NotFoundHandler = correlate(http.HandlerFunc(a.routeNotFound))
+  a.Router.MethodNotAllowedHandler = correlate(http.HandlerFunc(a.methodNotAllowed))
   a.initializeRoutes()
 
   applicationLog.Info("application is initialized")
 }
 
+// initializeLogger expects a configuration checked by Configuration.Validate
 func (a *Application) initializeLogger() {
   switch a.Config.Verbosity {
   case "fatal":
@@ -108,10 +86,6 @@ func (a *Application) initializeLogger() {
   case "debug":
     log.SetLevel(log.DebugLevel)
     log.SetReportCaller(false)
-  default:
-    log.WithFields(
-      log.Fields{"verbosity": a.Config.Verbosity},
-    ).Fatal("Unkown verbosity level")
   }
 
   switch a.Config.Environment {
@@ -121,10 +95,6 @@ func (a *Application) initializeLogger() {
     log.SetFormatter(&log.JSONFormatter{})
   case "production":
     log.SetFormatter(&log.JSONFormatter{})
-  default:
-    log.WithFields(
-      log.Fields{"environment": a.Config.Environment},
-    ).Fatal("Unkown environment type")
   }
 
   if a.Config.LogFormat != "unset" {
@@ -133,10 +103,6 @@ func (a *Application) initializeLogger() {
       log.SetFormatter(&log.TextFormatter{})
     case "json":
       log.SetFormatter(&log.JSONFormatter{})
-    default:
-      log.WithFields(
-        log.Fields{"log_format": a.Config.LogFormat},
-      ).Fatal("Unkown log format")
     }
   }
 }
@@ -144,15 +110,25 @@ func (a *Application) initializeLogger() {
 func (a *Application) initializeRoutes() {
   // application resource-related routes
   a.Router.HandleFunc("/resources", a.getResources).Methods("GET")
+  a.Router.HandleFunc("/resources/search", a.searchResources).Methods("GET")
+  a.Router.HandleFunc("/resources/trash", a.getTrashedResources).Methods("GET")
   a.Router.HandleFunc("/resource", a.createResource).Methods("POST")
   a.Router.HandleFunc("/resource/{id:[0-9]+}", a.getResource).Methods("GET")
   a.Router.HandleFunc("/resource/{id:[0-9]+}", a.updateResource).Methods("PUT")
+  a.Router.HandleFunc("/resource/{id:[0-9]+}", a.patchResource).Methods("PATCH")
   a.Router.HandleFunc("/resource/{id:[0-9]+}", a.deleteResource).Methods("DELETE")
+  a.Router.HandleFunc("/resource/{id:[0-9]+}/restore", a.restoreResource).Methods("POST")
+  a.Router.HandleFunc("/resource/{id:[0-9]+}/history", a.getResourceHistory).Methods("GET")
+  a.Router.HandleFunc("/resource/{id:[0-9]+}/history/{revision:[0-9]+}", a.getResourceRevision).Methods("GET")
+  a.Router.HandleFunc("/resource/{id:[0-9]+}/history/{revision:[0-9]+}/revert", a.revertResource).Methods("POST")
+  a.Router.HandleFunc("/resource/{id:[0-9]+}/need/{need:[0-9]+}", a.attachNeed).Methods("PUT")
+  a.Router.HandleFunc("/resource/{id:[0-9]+}/need/{need:[0-9]+}", a.detachNeed).Methods("DELETE")
+  a.Router.HandleFunc("/need/{need:[0-9]+}/resources", a.getNeedResources).Methods("GET")
   // application probes routes
   a.Router.HandleFunc("/health", a.isHealthy).Methods("GET")
   a.Router.HandleFunc("/ready", a.isReady).Methods("GET")
   // application maintenance routes
-  a.Router.HandleFunc("/initialize_db", a.InitializeDB).Methods("GET")
+  a.Router.HandleFunc("/initialize_db", a.InitializeDB).Methods("POST")
 }
 
 func (a *Application) Run(ctx context.Context) {
@@ -189,7 +165,25 @@ commit: %s
   go func() {
     // we keep this log on standard format
     log.Info(server_message)
-    applicationLog.Fatal(httpServer.ListenAndServe())
+
+    if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+      applicationLog.Fatal(err)
+    }
+  }()
+
+  // background jobs stop with the server
+  var jobs sync.WaitGroup
+
+  jobs.Add(1)
+  go func() {
+    defer jobs.Done()
+    a.purgeTrash(ctx)
+  }()
+
+  jobs.Add(1)
+  go func() {
+    defer jobs.Done()
+    a.relayEvents(ctx)
   }()
 
   <-ctx.Done()
@@ -208,6 +202,16 @@ commit: %s
     }).Fatal("server shutdown failed")
 	}
 
+  jobs.Wait()
+
+  if a.Events != nil {
+    if err := a.Events.Close(); err != nil {
+      applicationLog.WithFields(log.Fields{
+        "error": err,
+      }).Warn("could not close the connection to the message broker")
+    }
+  }
+
   applicationLog.Info("server exited properly")
 
 	if err == http.ErrServerClosed {
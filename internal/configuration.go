@@ -0,0 +1,484 @@
+package internal
+
+import (
+  fmt     "fmt"
+  io      "io"
+  ioutil  "io/ioutil"
+  reflect "reflect"
+  sort    "sort"
+  strconv "strconv"
+  strings "strings"
+  url     "net/url"
+  yaml    "gopkg.in/yaml.v2"
+)
+
+type Configuration struct {
+  Environment    string `yaml:"environment"`
+  Verbosity      string `yaml:"verbosity"`
+  LogFormat      string `yaml:"log_format"`
+  LogHealthcheck bool   `yaml:"log_healthcheck"`
+  Server struct {
+    Host string `yaml:"host"`
+    Port string `yaml:"port"`
+  } `yaml:"server"`
+  Database struct {
+    Host     string `yaml:"host"`
+    Port     string `yaml:"port"`
+    Name     string `yaml:"name"`
+    Username string `yaml:"username"`
+    Password string `yaml:"password"`
+    // PasswordFile, when set, replaces Password with the file content
+    PasswordFile    string `yaml:"password_file"`
+    SSLMode         string `yaml:"sslmode"`
+    SSLRootCert     string `yaml:"sslrootcert"`
+    SSLCert         string `yaml:"sslcert"`
+    SSLKey          string `yaml:"sslkey"`
+    // ConnectTimeout is in seconds, 0 waits indefinitely
+    ConnectTimeout  int    `yaml:"connect_timeout"`
+    ApplicationName string `yaml:"application_name"`
+    SearchPath      string `yaml:"search_path"`
+    // WaitTimeout is how long, in seconds, the startup waits for the database
+    WaitTimeout        int  `yaml:"wait_timeout"`
+    // AllowDegradedStart serves requests, while not ready, when the database
+    // is still unreachable after WaitTimeout
+    AllowDegradedStart bool `yaml:"allow_degraded_start"`
+    Pool struct {
+      MaxIdleConns    int `yaml:"max_idle_conns"`
+      MaxOpenConns    int `yaml:"max_open_conns"`
+      // ConnMaxLifetime and ConnMaxIdleTime are in seconds, 0 is unlimited
+      ConnMaxLifetime int `yaml:"conn_max_lifetime"`
+      ConnMaxIdleTime int `yaml:"conn_max_idle_time"`
+    } `yaml:"pool"`
+  } `yaml:"database"`
+  Amqp struct {
+    // Enabled publishes the resource lifecycle events to the broker
+    Enabled     bool   `yaml:"enabled"`
+    Host        string `yaml:"host"`
+    Port        string `yaml:"port"`
+    Username    string `yaml:"username"`
+    Password    string `yaml:"password"`
+    VirtualHost string `yaml:"virtual_host"`
+    Exchange    string `yaml:"exchange"`
+    // Timeout is how long, in seconds, to wait for the connection and for the
+    // confirmation of an event
+    Timeout     int    `yaml:"timeout"`
+  } `yaml:"amqp"`
+  Outbox struct {
+    // PollInterval is how long, in seconds, the relay waits for new events
+    PollInterval   int `yaml:"poll_interval"`
+    // RetentionHours is how long delivered events are kept, 0 keeps them
+    RetentionHours int `yaml:"retention_hours"`
+  } `yaml:"outbox"`
+  Healthcheck struct {
+    Timeout  int `yaml:"timeout"`
+  } `yaml:"healthcheck"`
+  Pagination struct {
+    DefaultPageSize int `yaml:"default_page_size"`
+    MaxPageSize     int `yaml:"max_page_size"`
+  } `yaml:"pagination"`
+  Maintenance struct {
+    Token string `yaml:"token"`
+  } `yaml:"maintenance"`
+  Concurrency struct {
+    // RequireIfMatch rejects the changes of resources sent without If-Match
+    RequireIfMatch bool `yaml:"require_if_match"`
+  } `yaml:"concurrency"`
+  Trash struct {
+    // RetentionDays is how long deleted resources stay in the trash before
+    // being purged, 0 never purges them
+    RetentionDays int `yaml:"retention_days"`
+    // PurgeInterval is in seconds
+    PurgeInterval int `yaml:"purge_interval"`
+  } `yaml:"trash"`
+  Need struct {
+    // URL is the base URL of the need service, which checks the needs linked
+    // to resources; they are not checked when empty
+    URL     string `yaml:"url"`
+    // Timeout is in seconds
+    Timeout int    `yaml:"timeout"`
+  } `yaml:"need"`
+}
+
+const redacted = "<redacted>"
+
+// EnvironmentPrefix prefixes the environment variables of every configuration
+// value, e.g. NEEDYS_API_RESOURCE_DATABASE_HOST for database.host
+const EnvironmentPrefix = "NEEDYS_API_RESOURCE_"
+
+// DefaultConfiguration returns the configuration used when neither a file,
+// the environment nor flags override a value
+func DefaultConfiguration() *Configuration {
+  c := &Configuration{}
+
+  c.Environment    = "production"
+  c.Verbosity      = "info"
+  c.LogFormat      = "unset"
+  c.LogHealthcheck = false
+
+  c.Server.Host = "localhost"
+  c.Server.Port = "8012"
+
+  c.Database.Host     = "localhost"
+  c.Database.Port     = "5432"
+  c.Database.Name     = "postgres"
+  c.Database.Username = "postgres"
+  c.Database.Password = "postgres"
+
+  c.Database.SSLMode         = "disable"
+  c.Database.ConnectTimeout  = 10
+  c.Database.ApplicationName = "needys-api-resource"
+
+  c.Database.WaitTimeout        = 60
+  c.Database.AllowDegradedStart = false
+
+  c.Database.Pool.MaxIdleConns    = 3
+  c.Database.Pool.MaxOpenConns    = 10
+  c.Database.Pool.ConnMaxLifetime = 3600
+  c.Database.Pool.ConnMaxIdleTime = 0
+
+  c.Amqp.Enabled     = false
+  c.Amqp.Host        = "localhost"
+  c.Amqp.Port        = "5672"
+  c.Amqp.Username    = "guest"
+  c.Amqp.Password    = "guest"
+  c.Amqp.VirtualHost = "/"
+  c.Amqp.Exchange    = "needys.resources"
+  c.Amqp.Timeout     = 5
+
+  c.Outbox.PollInterval   = 1
+  c.Outbox.RetentionHours = 24
+
+  c.Healthcheck.Timeout = 5
+
+  c.Pagination.DefaultPageSize = 10
+  c.Pagination.MaxPageSize     = 100
+
+  c.Concurrency.RequireIfMatch = false
+
+  c.Trash.RetentionDays = 30
+  c.Trash.PurgeInterval = 3600
+
+  c.Need.URL     = ""
+  c.Need.Timeout = 5
+
+  return c
+}
+
+// LoadConfiguration layers the configuration: the defaults, overridden by the
+// file at path unless it is empty, then by the environment, then by the
+// flags, given by YAML key
+func LoadConfiguration(path string, lookup func(string) (string, bool), flags map[string]string) (*Configuration, error) {
+  c := DefaultConfiguration()
+
+  if path != "" {
+    if err := c.LoadFile(path); err != nil {
+      return nil, err
+    }
+  }
+
+  if err := c.LoadEnvironment(lookup); err != nil {
+    return nil, err
+  }
+
+  if err := c.LoadFlags(flags); err != nil {
+    return nil, err
+  }
+
+  return c, nil
+}
+
+// LoadFile overrides the configuration with the values set in a YAML file;
+// the values absent from the file are kept
+func (c *Configuration) LoadFile(path string) error {
+  content, err := ioutil.ReadFile(path)
+  if err != nil {
+    return fmt.Errorf("cannot read configuration file: %s", err)
+  }
+
+  if err = yaml.UnmarshalStrict(content, c); err != nil {
+    return fmt.Errorf("invalid configuration file %s: %s", path, err)
+  }
+
+  return nil
+}
+
+// LoadEnvironment overrides the configuration with the environment variables
+// named after the YAML keys; lookup is usually os.LookupEnv. Every invalid
+// value is reported in the returned error.
+func (c *Configuration) LoadEnvironment(lookup func(string) (string, bool)) error {
+  var problems []string
+
+  walkConfiguration(reflect.ValueOf(c).Elem(), "", func(key string, field reflect.Value) {
+    name := EnvironmentVariable(key)
+
+    value, found := lookup(name)
+    if !found {
+      return
+    }
+
+    if err := setFromString(field, value); err != nil {
+      problems = append(problems, fmt.Sprintf("%s=%q: %s", name, value, err))
+    }
+  })
+
+  if len(problems) > 0 {
+    return fmt.Errorf("invalid environment variables: %s", strings.Join(problems, "; "))
+  }
+
+  return nil
+}
+
+// LoadFlags overrides the configuration with the values of flags, by YAML key
+// like "database.host". Every unknown key and invalid value is reported in the
+// returned error.
+func (c *Configuration) LoadFlags(flags map[string]string) error {
+  var problems []string
+  known := make(map[string]bool)
+
+  walkConfiguration(reflect.ValueOf(c).Elem(), "", func(key string, field reflect.Value) {
+    known[key] = true
+
+    value, found := flags[key]
+    if !found {
+      return
+    }
+
+    if err := setFromString(field, value); err != nil {
+      problems = append(problems, fmt.Sprintf("--%s=%q: %s", FlagName(key), value, err))
+    }
+  })
+
+  for key := range flags {
+    if !known[key] {
+      problems = append(problems, fmt.Sprintf("--%s: unknown flag", FlagName(key)))
+    }
+  }
+
+  if len(problems) > 0 {
+    sort.Strings(problems)
+    return fmt.Errorf("invalid flags: %s", strings.Join(problems, "; "))
+  }
+
+  return nil
+}
+
+// ConfigurationKeys returns the YAML key of every configuration value
+func ConfigurationKeys() []string {
+  var keys []string
+
+  walkConfiguration(reflect.ValueOf(Configuration{}), "", func(key string, _ reflect.Value) {
+    keys = append(keys, key)
+  })
+
+  return keys
+}
+
+// FlagName returns the command line flag bound to a YAML key like
+// "database.password_file", i.e. database.password-file
+func FlagName(key string) string {
+  return strings.Replace(key, "_", "-", -1)
+}
+
+// EnvironmentVariable returns the variable bound to a YAML key like
+// "database.host"
+func EnvironmentVariable(key string) string {
+  return EnvironmentPrefix + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+}
+
+// walkConfiguration calls fn on every leaf field with its dotted YAML key
+func walkConfiguration(v reflect.Value, prefix string, fn func(string, reflect.Value)) {
+  t := v.Type()
+
+  for i := 0; i < t.NumField(); i++ {
+    tag := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+    if tag == "" || tag == "-" {
+      continue
+    }
+
+    key := prefix + tag
+
+    if v.Field(i).Kind() == reflect.Struct {
+      walkConfiguration(v.Field(i), key + ".", fn)
+    } else {
+      fn(key, v.Field(i))
+    }
+  }
+}
+
+func setFromString(field reflect.Value, value string) error {
+  switch field.Kind() {
+  case reflect.String:
+    field.SetString(value)
+  case reflect.Bool:
+    b, err := strconv.ParseBool(value)
+    if err != nil {
+      return fmt.Errorf("expected a boolean (true, false)")
+    }
+    field.SetBool(b)
+  case reflect.Int:
+    n, err := strconv.Atoi(value)
+    if err != nil {
+      return fmt.Errorf("expected an integer")
+    }
+    field.SetInt(int64(n))
+  default:
+    return fmt.Errorf("unsupported type %s", field.Kind())
+  }
+
+  return nil
+}
+
+// ConfigurationError lists every problem found by Validate
+type ConfigurationError struct {
+  Problems []string
+}
+
+func (e *ConfigurationError) Error() string {
+  return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+var (
+  knownEnvironments = []string{"development", "integration", "production"}
+  knownVerbosities  = []string{"fatal", "error", "warning", "info", "debug"}
+  knownLogFormats   = []string{"unset", "text", "json"}
+  knownSSLModes     = []string{"disable", "require", "verify-ca", "verify-full"}
+)
+
+// Validate checks every configuration value and reports all the problems at
+// once, as a *ConfigurationError
+func (c *Configuration) Validate() error {
+  var problems []string
+
+  oneOf := func(key, value string, known []string) {
+    for _, k := range known {
+      if value == k {
+        return
+      }
+    }
+    problems = append(problems,
+      fmt.Sprintf("%s: unknown value %q, expected one of %s", key, value, strings.Join(known, ", ")))
+  }
+
+  notEmpty := func(key, value string) {
+    if strings.TrimSpace(value) == "" {
+      problems = append(problems, fmt.Sprintf("%s: must not be empty", key))
+    }
+  }
+
+  port := func(key, value string) {
+    if p, err := strconv.Atoi(value); err != nil || p < 1 || p > 65535 {
+      problems = append(problems, fmt.Sprintf("%s: %q is not a port between 1 and 65535", key, value))
+    }
+  }
+
+  positiveOrZero := func(key string, value int) {
+    if value < 0 {
+      problems = append(problems, fmt.Sprintf("%s: must not be negative, got %d", key, value))
+    }
+  }
+
+  positive := func(key string, value int) {
+    if value <= 0 {
+      problems = append(problems, fmt.Sprintf("%s: must be greater than 0, got %d", key, value))
+    }
+  }
+
+  oneOf("environment", c.Environment, knownEnvironments)
+  oneOf("verbosity", c.Verbosity, knownVerbosities)
+  oneOf("log_format", c.LogFormat, knownLogFormats)
+
+  notEmpty("server.host", c.Server.Host)
+  port("server.port", c.Server.Port)
+
+  notEmpty("database.host", c.Database.Host)
+  port("database.port", c.Database.Port)
+  notEmpty("database.name", c.Database.Name)
+  notEmpty("database.username", c.Database.Username)
+  oneOf("database.sslmode", c.Database.SSLMode, knownSSLModes)
+
+  if (c.Database.SSLCert == "") != (c.Database.SSLKey == "") {
+    problems = append(problems, "database.sslcert and database.sslkey must be set together")
+  }
+
+  // the password file is read again on SIGHUP, but it must be readable at
+  // startup
+  if c.Database.PasswordFile != "" {
+    if _, err := ioutil.ReadFile(c.Database.PasswordFile); err != nil {
+      problems = append(problems, fmt.Sprintf("database.password_file: cannot be read: %s", err))
+    }
+  }
+
+  positiveOrZero("database.connect_timeout", c.Database.ConnectTimeout)
+  positive("database.wait_timeout", c.Database.WaitTimeout)
+  positiveOrZero("database.pool.max_idle_conns", c.Database.Pool.MaxIdleConns)
+  positiveOrZero("database.pool.max_open_conns", c.Database.Pool.MaxOpenConns)
+  positiveOrZero("database.pool.conn_max_lifetime", c.Database.Pool.ConnMaxLifetime)
+  positiveOrZero("database.pool.conn_max_idle_time", c.Database.Pool.ConnMaxIdleTime)
+
+  if c.Amqp.Enabled {
+    notEmpty("amqp.host", c.Amqp.Host)
+    port("amqp.port", c.Amqp.Port)
+    notEmpty("amqp.exchange", c.Amqp.Exchange)
+    positive("amqp.timeout", c.Amqp.Timeout)
+  }
+
+  positive("outbox.poll_interval", c.Outbox.PollInterval)
+  positiveOrZero("outbox.retention_hours", c.Outbox.RetentionHours)
+
+  positive("healthcheck.timeout", c.Healthcheck.Timeout)
+
+  positive("pagination.default_page_size", c.Pagination.DefaultPageSize)
+  positive("pagination.max_page_size", c.Pagination.MaxPageSize)
+
+  if c.Pagination.DefaultPageSize > c.Pagination.MaxPageSize {
+    problems = append(problems, "pagination.default_page_size must not be greater than pagination.max_page_size")
+  }
+
+  positiveOrZero("trash.retention_days", c.Trash.RetentionDays)
+  positive("trash.purge_interval", c.Trash.PurgeInterval)
+
+  if c.Need.URL != "" {
+    if u, err := url.Parse(c.Need.URL); err != nil || u.Scheme == "" || u.Host == "" {
+      problems = append(problems, fmt.Sprintf("need.url: %q is not an absolute URL", c.Need.URL))
+    }
+  }
+
+  positive("need.timeout", c.Need.Timeout)
+
+  if len(problems) > 0 {
+    return &ConfigurationError{Problems: problems}
+  }
+
+  return nil
+}
+
+// Redacted returns a copy of the configuration without its secrets
+func (c *Configuration) Redacted() Configuration {
+  r := *c
+
+  if r.Database.Password != "" {
+    r.Database.Password = redacted
+  }
+
+  if r.Amqp.Password != "" {
+    r.Amqp.Password = redacted
+  }
+
+  if r.Maintenance.Token != "" {
+    r.Maintenance.Token = redacted
+  }
+
+  return r
+}
+
+// Print writes the redacted configuration as YAML
+func (c *Configuration) Print(w io.Writer) error {
+  content, err := yaml.Marshal(c.Redacted())
+  if err != nil {
+    return err
+  }
+
+  _, err = w.Write(content)
+
+  return err
+}
@@ -0,0 +1,365 @@
+package internal
+
+import (
+	ioutil   "io/ioutil"
+	filepath "path/filepath"
+	strings  "strings"
+	testing  "testing"
+)
+
+// writeFile writes content in a file of a temporary directory, and returns
+// its path
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("could not write %s: %s", path, err)
+	}
+
+	return path
+}
+
+// environment looks variables up in a map, like os.LookupEnv
+func environment(variables map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, found := variables[name]
+		return value, found
+	}
+}
+
+func TestLoadConfigurationPrecedence(t *testing.T) {
+	file := "database:\n  host: file-host\n  pool:\n    max_open_conns: 20\n"
+
+	tests := []struct {
+		name         string
+		file         string
+		env          map[string]string
+		flags        map[string]string
+		host         string
+		maxOpenConns int
+	}{
+		{
+			name: "defaults",
+			host: "localhost",
+			maxOpenConns: 10,
+		},
+		{
+			name: "file over defaults",
+			file: file,
+			host: "file-host",
+			maxOpenConns: 20,
+		},
+		{
+			name: "environment over file",
+			file: file,
+			env: map[string]string{"NEEDYS_API_RESOURCE_DATABASE_HOST": "env-host"},
+			host: "env-host",
+			maxOpenConns: 20,
+		},
+		{
+			name: "flags over environment",
+			file: file,
+			env: map[string]string{
+				"NEEDYS_API_RESOURCE_DATABASE_HOST": "env-host",
+				"NEEDYS_API_RESOURCE_DATABASE_POOL_MAX_OPEN_CONNS": "30",
+			},
+			flags: map[string]string{"database.host": "flag-host"},
+			host: "flag-host",
+			maxOpenConns: 30,
+		},
+		{
+			name: "flags over defaults",
+			flags: map[string]string{"database.pool.max_open_conns": "40"},
+			host: "localhost",
+			maxOpenConns: 40,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := ""
+
+			if test.file != "" {
+				path = writeFile(t, "config.yml", test.file)
+			}
+
+			c, err := LoadConfiguration(path, environment(test.env), test.flags)
+			if err != nil {
+				t.Fatalf("could not load the configuration: %s", err)
+			}
+
+			if c.Database.Host != test.host {
+				t.Errorf("expected database.host to be: %q, but actual is: %q", test.host, c.Database.Host)
+			}
+
+			if c.Database.Pool.MaxOpenConns != test.maxOpenConns {
+				t.Errorf("expected database.pool.max_open_conns to be: %d, but actual is: %d",
+					test.maxOpenConns, c.Database.Pool.MaxOpenConns)
+			}
+		})
+	}
+}
+
+func TestLoadFileIsStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{"known keys", "server:\n  port: \"9000\"\n", true},
+		{"unknown key", "server:\n  prot: \"9000\"\n", false},
+		{"unknown section", "serveur:\n  port: \"9000\"\n", false},
+		{"wrong type", "database:\n  pool:\n    max_open_conns: many\n", false},
+		{"malformed YAML", "server: [\n", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := DefaultConfiguration().LoadFile(writeFile(t, "config.yml", test.content))
+
+			if test.valid && err != nil {
+				t.Errorf("expected the file to be loaded, but got: %s", err)
+			}
+
+			if !test.valid && err == nil {
+				t.Error("expected the file to be rejected")
+			}
+		})
+	}
+}
+
+func TestLoadFileKeepsTheAbsentValues(t *testing.T) {
+	c := DefaultConfiguration()
+
+	if err := c.LoadFile(writeFile(t, "config.yml", "server:\n  port: \"9000\"\n")); err != nil {
+		t.Fatalf("could not load the file: %s", err)
+	}
+
+	if c.Server.Port != "9000" || c.Server.Host != "localhost" {
+		t.Errorf("expected the server to be localhost:9000, but actual is: %s:%s", c.Server.Host, c.Server.Port)
+	}
+}
+
+func TestLoadFlagsRejectsUnknownFlags(t *testing.T) {
+	err := DefaultConfiguration().LoadFlags(map[string]string{"database.hots": "somewhere"})
+
+	if err == nil || !strings.Contains(err.Error(), "--database.hots") {
+		t.Errorf("expected the unknown flag to be reported, but got: %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		token    string
+		expected string
+	}{
+		{"secrets set", "secret", "token", redacted},
+		{"secrets empty", "", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := DefaultConfiguration()
+			c.Database.Password = test.password
+			c.Amqp.Password = test.password
+			c.Maintenance.Token = test.token
+
+			r := c.Redacted()
+
+			if r.Database.Password != test.expected || r.Amqp.Password != test.expected || r.Maintenance.Token != test.expected {
+				t.Errorf("expected the secrets to be: %q, but actual are: %q, %q and %q",
+					test.expected, r.Database.Password, r.Amqp.Password, r.Maintenance.Token)
+			}
+
+			if c.Database.Password != test.password || c.Maintenance.Token != test.token {
+				t.Error("expected the configuration itself to keep its secrets")
+			}
+
+			var printed strings.Builder
+
+			if err := c.Print(&printed); err != nil {
+				t.Fatalf("could not print the configuration: %s", err)
+			}
+
+			if test.password != "" && strings.Contains(printed.String(), test.password) {
+				t.Errorf("expected the printed configuration not to contain the secrets:\n%s", printed.String())
+			}
+		})
+	}
+}
+
+func TestEnvironmentVariable(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{"server.host", "NEEDYS_API_RESOURCE_SERVER_HOST"},
+		{"log_healthcheck", "NEEDYS_API_RESOURCE_LOG_HEALTHCHECK"},
+		{"database.pool.max_open_conns", "NEEDYS_API_RESOURCE_DATABASE_POOL_MAX_OPEN_CONNS"},
+	}
+
+	for _, test := range tests {
+		if actual := EnvironmentVariable(test.key); actual != test.expected {
+			t.Errorf("expected the variable of %s to be: %s, but actual is: %s", test.key, test.expected, actual)
+		}
+	}
+}
+
+func TestLoadEnvironmentParsesTheTypes(t *testing.T) {
+	tests := []struct {
+		variable string
+		value    string
+		actual   func(*Configuration) interface{}
+		expected interface{}
+	}{
+		{"NEEDYS_API_RESOURCE_DATABASE_NAME", "resources", func(c *Configuration) interface{} { return c.Database.Name }, "resources"},
+		{"NEEDYS_API_RESOURCE_DATABASE_NAME", "", func(c *Configuration) interface{} { return c.Database.Name }, ""},
+		{"NEEDYS_API_RESOURCE_DATABASE_POOL_MAX_OPEN_CONNS", "25", func(c *Configuration) interface{} { return c.Database.Pool.MaxOpenConns }, 25},
+		{"NEEDYS_API_RESOURCE_DATABASE_CONNECT_TIMEOUT", "0", func(c *Configuration) interface{} { return c.Database.ConnectTimeout }, 0},
+		{"NEEDYS_API_RESOURCE_DATABASE_POOL_MAX_IDLE_CONNS", "-1", func(c *Configuration) interface{} { return c.Database.Pool.MaxIdleConns }, -1},
+		{"NEEDYS_API_RESOURCE_AMQP_ENABLED", "true", func(c *Configuration) interface{} { return c.Amqp.Enabled }, true},
+		{"NEEDYS_API_RESOURCE_AMQP_ENABLED", "1", func(c *Configuration) interface{} { return c.Amqp.Enabled }, true},
+		{"NEEDYS_API_RESOURCE_LOG_HEALTHCHECK", "false", func(c *Configuration) interface{} { return c.LogHealthcheck }, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.variable + "=" + test.value, func(t *testing.T) {
+			c := DefaultConfiguration()
+
+			if err := c.LoadEnvironment(environment(map[string]string{test.variable: test.value})); err != nil {
+				t.Fatalf("could not load the environment: %s", err)
+			}
+
+			if actual := test.actual(c); actual != test.expected {
+				t.Errorf("expected %s to set: %v, but actual is: %v", test.variable, test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLoadEnvironmentRejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name      string
+		variables map[string]string
+		problems  []string
+	}{
+		{
+			name: "non-integer",
+			variables: map[string]string{"NEEDYS_API_RESOURCE_DATABASE_POOL_MAX_OPEN_CONNS": "ten"},
+			problems: []string{`NEEDYS_API_RESOURCE_DATABASE_POOL_MAX_OPEN_CONNS="ten": expected an integer`},
+		},
+		{
+			name: "decimal",
+			variables: map[string]string{"NEEDYS_API_RESOURCE_NEED_TIMEOUT": "2.5"},
+			problems: []string{`NEEDYS_API_RESOURCE_NEED_TIMEOUT="2.5": expected an integer`},
+		},
+		{
+			name: "non-boolean",
+			variables: map[string]string{"NEEDYS_API_RESOURCE_AMQP_ENABLED": "yes"},
+			problems: []string{`NEEDYS_API_RESOURCE_AMQP_ENABLED="yes": expected a boolean`},
+		},
+		{
+			name: "several",
+			variables: map[string]string{
+				"NEEDYS_API_RESOURCE_DATABASE_POOL_MAX_OPEN_CONNS": "ten",
+				"NEEDYS_API_RESOURCE_AMQP_ENABLED": "yes",
+			},
+			problems: []string{"NEEDYS_API_RESOURCE_DATABASE_POOL_MAX_OPEN_CONNS", "NEEDYS_API_RESOURCE_AMQP_ENABLED"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := DefaultConfiguration().LoadEnvironment(environment(test.variables))
+			if err == nil {
+				t.Fatal("expected the environment to be rejected")
+			}
+
+			for _, problem := range test.problems {
+				if !strings.Contains(err.Error(), problem) {
+					t.Errorf("expected the error to report: %s, but actual is: %s", problem, err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	passwordFile := writeFile(t, "password", "secret\n")
+
+	tests := []struct {
+		name     string
+		change   func(*Configuration)
+		problems []string
+	}{
+		{
+			name: "defaults",
+			change: func(c *Configuration) {},
+		},
+		{
+			name: "readable password file",
+			change: func(c *Configuration) { c.Database.PasswordFile = passwordFile },
+		},
+		{
+			name: "unreadable password file",
+			change: func(c *Configuration) { c.Database.PasswordFile = filepath.Join(t.TempDir(), "missing") },
+			problems: []string{"database.password_file: cannot be read"},
+		},
+		{
+			name: "unknown environment",
+			change: func(c *Configuration) { c.Environment = "staging" },
+			problems: []string{`environment: unknown value "staging"`},
+		},
+		{
+			name: "several problems",
+			change: func(c *Configuration) {
+				c.Server.Port = "0"
+				c.Database.Pool.MaxOpenConns = -1
+				c.Database.SSLCert = "client.crt"
+				c.Need.URL = "needs"
+				c.Pagination.DefaultPageSize = c.Pagination.MaxPageSize + 1
+			},
+			problems: []string{
+				`server.port: "0" is not a port`,
+				"database.sslcert and database.sslkey must be set together",
+				"database.pool.max_open_conns: must not be negative",
+				"pagination.default_page_size must not be greater than pagination.max_page_size",
+				`need.url: "needs" is not an absolute URL`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := DefaultConfiguration()
+			test.change(c)
+
+			err := c.Validate()
+
+			if len(test.problems) == 0 {
+				if err != nil {
+					t.Fatalf("expected the configuration to be valid, but got: %s", err)
+				}
+				return
+			}
+
+			configurationError, ok := err.(*ConfigurationError)
+			if !ok {
+				t.Fatalf("expected a *ConfigurationError, but actual is: %v", err)
+			}
+
+			if len(configurationError.Problems) != len(test.problems) {
+				t.Fatalf("expected %d problems, but actual are: %q", len(test.problems), configurationError.Problems)
+			}
+
+			for i, problem := range test.problems {
+				if !strings.HasPrefix(configurationError.Problems[i], problem) {
+					t.Errorf("expected the problem %d to start with: %s, but actual is: %s",
+						i, problem, configurationError.Problems[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package internal
+
+import (
+  context  "context"
+  driver   "database/sql/driver"
+  fmt      "fmt"
+  ioutil   "io/ioutil"
+  log      "github.com/sirupsen/logrus"
+  pq       "github.com/lib/pq"
+  resource "github.com/gpenaud/needys-api-resource/internal/resource"
+  sql      "database/sql"
+  strconv  "strconv"
+  strings  "strings"
+  time     "time"
+)
+
+var databaseLog *log.Entry
+
+func init() {
+  databaseLog = log.WithFields(log.Fields{
+    "_file": "internal/database.go",
+    "_type": "system",
+  })
+}
+
+func (a *Application) initializeDatabase() {
+  db, err := a.openDatabase()
+  if err != nil {
+    databaseLog.WithFields(log.Fields{
+      "error": err,
+    }).Fatal("cannot open database")
+  }
+
+  a.Store = resource.NewPostgresStore(db)
+
+  databaseLog.WithFields(log.Fields{
+    "database_host": a.Config.Database.Host,
+    "database_port": a.Config.Database.Port,
+    "database_username": a.Config.Database.Username,
+    "database_name":   a.Config.Database.Name,
+  }).Info("trying to connect to database")
+
+  if err = a.waitForDatabase(db); err == nil {
+    databaseLog.Info("database is reachable")
+  } else if a.Config.Database.AllowDegradedStart {
+    databaseLog.WithFields(log.Fields{
+      "error": err,
+    }).Warn("database is unreachable, starting in a degraded state until it is")
+  } else {
+    databaseLog.WithFields(log.Fields{
+      "error": err,
+    }).Fatal("database is unreachable")
+  }
+}
+
+const (
+  initialRetryDelay = 500 * time.Millisecond
+  maximumRetryDelay = 30 * time.Second
+)
+
+// waitForDatabase pings the database with an exponential backoff, until it
+// answers or Database.WaitTimeout is elapsed
+func (a *Application) waitForDatabase(db *sql.DB) error {
+  timeout := time.Duration(a.Config.Database.WaitTimeout) * time.Second
+
+  ctx, cancel := context.WithTimeout(context.Background(), timeout)
+  defer cancel()
+
+  delay := initialRetryDelay
+
+  for attempt := 1; ; attempt++ {
+    err := db.PingContext(ctx)
+    if err == nil {
+      return nil
+    }
+
+    databaseLog.WithFields(log.Fields{
+      "attempt": attempt,
+      "error": err,
+      "retry_in": delay.String(),
+    }).Warn("database ping failed")
+
+    select {
+    case <-ctx.Done():
+      return fmt.Errorf("gave up after %d attempts in %s: %s", attempt, timeout, err)
+    case <-time.After(delay):
+    }
+
+    if delay *= 2; delay > maximumRetryDelay {
+      delay = maximumRetryDelay
+    }
+  }
+}
+
+func (a *Application) openDatabase() (*sql.DB, error) {
+  if err := a.ReloadDatabasePassword(); err != nil {
+    return nil, err
+  }
+
+  db := sql.OpenDB(&connector{a})
+
+  pool := a.Config.Database.Pool
+
+  db.SetMaxIdleConns(pool.MaxIdleConns)
+  db.SetMaxOpenConns(pool.MaxOpenConns)
+  db.SetConnMaxLifetime(time.Duration(pool.ConnMaxLifetime) * time.Second)
+  db.SetConnMaxIdleTime(time.Duration(pool.ConnMaxIdleTime) * time.Second)
+
+  return db, nil
+}
+
+// ReloadDatabasePassword reads the database password file again, if any; the
+// new password is used by the connections opened afterwards
+func (a *Application) ReloadDatabasePassword() error {
+  path := a.Config.Database.PasswordFile
+  if path == "" {
+    return nil
+  }
+
+  content, err := ioutil.ReadFile(path)
+  if err != nil {
+    return fmt.Errorf("cannot read database password file: %s", err)
+  }
+
+  a.passwordMutex.Lock()
+  a.Config.Database.Password = strings.TrimRight(string(content), "\r\n")
+  a.passwordMutex.Unlock()
+
+  databaseLog.WithFields(log.Fields{
+    "password_file": path,
+  }).Info("database password has been loaded")
+
+  return nil
+}
+
+func (a *Application) connectionString() string {
+  a.passwordMutex.RLock()
+  defer a.passwordMutex.RUnlock()
+
+  database := a.Config.Database
+
+  parameters := []struct{ key, value string }{
+    {"host", database.Host},
+    {"port", database.Port},
+    {"user", database.Username},
+    {"password", database.Password},
+    {"dbname", database.Name},
+    {"sslmode", database.SSLMode},
+    {"sslrootcert", database.SSLRootCert},
+    {"sslcert", database.SSLCert},
+    {"sslkey", database.SSLKey},
+    {"connect_timeout", strconv.Itoa(database.ConnectTimeout)},
+    {"application_name", database.ApplicationName},
+    // unknown keys are sent by lib/pq as run-time parameters
+    {"search_path", database.SearchPath},
+  }
+
+  var connectionString []string
+
+  for _, p := range parameters {
+    if p.value != "" {
+      connectionString = append(connectionString, p.key + "=" + quoteConnectionValue(p.value))
+    }
+  }
+
+  return strings.Join(connectionString, " ")
+}
+
+// quoteConnectionValue quotes a value of a key/value connection string, as
+// described in the libpq documentation
+func quoteConnectionValue(value string) string {
+  value = strings.Replace(value, `\`, `\\`, -1)
+  value = strings.Replace(value, `'`, `\'`, -1)
+
+  return "'" + value + "'"
+}
+
+// connector builds the connection string on every new connection, so that a
+// reloaded password is taken into account without reopening the pool
+type connector struct {
+  a *Application
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+  pqConnector, err := pq.NewConnector(c.a.connectionString())
+  if err != nil {
+    return nil, err
+  }
+
+  return pqConnector.Connect(ctx)
+}
+
+func (c *connector) Driver() driver.Driver {
+  return &pq.Driver{}
+}
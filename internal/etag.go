@@ -0,0 +1,102 @@
+package internal
+
+import (
+  http     "net/http"
+  resource "github.com/gpenaud/needys-api-resource/internal/resource"
+  strconv  "strconv"
+  strings  "strings"
+)
+
+// -------------------------------------------------------------------------- //
+// Entity tags and conditional requests (RFC 7232)
+
+// etag is the strong entity tag of a version of a resource
+func etag(version int) string {
+  return `"` + strconv.Itoa(version) + `"`
+}
+
+// entityTags splits the list of entity tags of an If-Match or If-None-Match
+// header
+func entityTags(header string) []string {
+  var tags []string
+
+  for _, tag := range strings.Split(header, ",") {
+    if tag = strings.TrimSpace(tag); tag != "" {
+      tags = append(tags, tag)
+    }
+  }
+
+  return tags
+}
+
+// notModified tells whether If-None-Match matches the entity tag of the
+// current representation, with the weak comparison reads use
+func notModified(r *http.Request, tag string) bool {
+  for _, t := range entityTags(r.Header.Get("If-None-Match")) {
+    if t == "*" || strings.TrimPrefix(t, "W/") == tag {
+      return true
+    }
+  }
+
+  return false
+}
+
+// expectedVersion reads If-Match as the version the stored resource must have
+// to be changed, 0 when any version will do. Weak entity tags never match.
+func (a *Application) expectedVersion(r *http.Request, id int) (int, error) {
+  return a.matchVersion(r, id, a.Store.GetResource)
+}
+
+// expectedTrashedVersion is expectedVersion for a resource in the trash
+func (a *Application) expectedTrashedVersion(r *http.Request, id int) (int, error) {
+  return a.matchVersion(r, id, a.Store.GetTrashedResource)
+}
+
+// matchVersion reads If-Match for expectedVersion, reading the resource with
+// get when the header lists several versions
+func (a *Application) matchVersion(r *http.Request, id int, get func(*resource.Resource) error) (int, error) {
+  header := r.Header.Get("If-Match")
+
+  if header == "" {
+    if a.Config.Concurrency.RequireIfMatch {
+      return 0, preconditionRequired("The If-Match header is required to change a resource")
+    }
+
+    return 0, nil
+  }
+
+  var versions []int
+
+  for _, tag := range entityTags(header) {
+    if tag == "*" {
+      return 0, nil
+    }
+
+    if version, err := strconv.Atoi(strings.Trim(tag, `"`)); err == nil && etag(version) == tag {
+      versions = append(versions, version)
+    }
+  }
+
+  switch len(versions) {
+  case 0:
+    return 0, preconditionFailed("If-Match matches no version of the resource")
+  case 1:
+    return versions[0], nil
+  }
+
+  // among several versions, the current one is expected, and the store still
+  // checks it has not changed since
+  res := resource.Resource{ID: id}
+
+  if err := get(&res); err != nil {
+    return 0, err
+  }
+
+  for _, version := range versions {
+    if version == res.Version {
+      return version, nil
+    }
+  }
+
+  return 0, resource.ErrVersionMismatch
+}
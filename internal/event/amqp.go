@@ -0,0 +1,187 @@
+package event
+
+import (
+  context "context"
+  errors  "errors"
+  fmt     "fmt"
+  json    "encoding/json"
+  log     "github.com/sirupsen/logrus"
+  amqp    "github.com/streadway/amqp"
+  sync    "sync"
+  time    "time"
+)
+
+var amqpLog *log.Entry
+
+func init() {
+  amqpLog = log.WithFields(log.Fields{
+    "_file": "internal/event/amqp.go",
+    "_type": "system",
+  })
+}
+
+// ErrNotConfirmed is returned when the broker refuses an event
+var ErrNotConfirmed = errors.New("the broker did not confirm the event")
+
+// AMQPPublisher publishes events to a topic exchange, routed by their type,
+// and waits for the broker to confirm each of them. The connection is opened
+// on the first event and again on the next one after it is lost.
+type AMQPPublisher struct {
+  URL      string
+  Exchange string
+  // Timeout bounds the connection and the wait for a confirmation
+  Timeout  time.Duration
+
+  // serializes publications, so confirmations come in order
+  mutex      sync.Mutex
+  connection *amqp.Connection
+  channel    *amqp.Channel
+  confirms   chan amqp.Confirmation
+  closed     chan *amqp.Error
+}
+
+func NewAMQPPublisher(url, exchange string, timeout time.Duration) *AMQPPublisher {
+  return &AMQPPublisher{URL: url, Exchange: exchange, Timeout: timeout}
+}
+
+// connect opens a channel in confirm mode and declares the exchange
+func (p *AMQPPublisher) connect() error {
+  connection, err := amqp.DialConfig(p.URL, amqp.Config{
+    Dial: amqp.DefaultDial(p.Timeout),
+    Heartbeat: 10 * time.Second,
+    Locale: "en_US",
+  })
+
+  if err != nil {
+    return err
+  }
+
+  channel, err := connection.Channel()
+  if err == nil {
+    err = channel.ExchangeDeclare(p.Exchange, "topic", true, false, false, false, nil)
+  }
+
+  if err == nil {
+    err = channel.Confirm(false)
+  }
+
+  if err != nil {
+    connection.Close()
+    return err
+  }
+
+  p.connection = connection
+  p.channel = channel
+  p.confirms = channel.NotifyPublish(make(chan amqp.Confirmation, 1))
+  p.closed = channel.NotifyClose(make(chan *amqp.Error, 1))
+
+  amqpLog.WithFields(log.Fields{
+    "exchange": p.Exchange,
+  }).Info("connected to the message broker")
+
+  return nil
+}
+
+// lost tells whether the channel was closed, by the broker or with its
+// connection
+func (p *AMQPPublisher) lost() bool {
+  select {
+  case err := <-p.closed:
+    amqpLog.WithFields(log.Fields{
+      "error": err,
+    }).Warn("lost the channel to the message broker")
+
+    return true
+  default:
+    return false
+  }
+}
+
+// disconnect drops the connection, so the next event opens another one
+func (p *AMQPPublisher) disconnect() {
+  if p.connection != nil {
+    p.connection.Close()
+  }
+
+  p.connection = nil
+  p.channel = nil
+}
+
+func (p *AMQPPublisher) Publish(ctx context.Context, e Event) error {
+  body, err := json.Marshal(e)
+  if err != nil {
+    return err
+  }
+
+  p.mutex.Lock()
+  defer p.mutex.Unlock()
+
+  if p.channel != nil && p.lost() {
+    p.disconnect()
+  }
+
+  if p.channel == nil {
+    if err = p.connect(); err != nil {
+      return fmt.Errorf("cannot connect to the message broker: %s", err)
+    }
+  }
+
+  amqpLog.WithFields(log.Fields{
+    "type": "event publication",
+    "parameter_id": e.ID,
+    "parameter_type": e.Type,
+  }).Debug("publish on the exchange " + p.Exchange)
+
+  err = p.channel.Publish(p.Exchange, e.Type, false, false, amqp.Publishing{
+    ContentType: "application/json",
+    DeliveryMode: amqp.Persistent,
+    MessageId: e.ID,
+    CorrelationId: e.CorrelationID,
+    Timestamp: e.Time,
+    Type: e.Type,
+    AppId: e.Source,
+    Headers: amqp.Table{"version": int32(e.Version)},
+    Body: body,
+  })
+
+  if err != nil {
+    p.disconnect()
+    return err
+  }
+
+  timeout := time.NewTimer(p.Timeout)
+  defer timeout.Stop()
+
+  // a confirmation left behind would be taken for the one of the next event,
+  // so the channel is dropped on every failure
+  select {
+  case confirmation, open := <-p.confirms:
+    if !open || !confirmation.Ack {
+      p.disconnect()
+      return ErrNotConfirmed
+    }
+
+    return nil
+  case <-timeout.C:
+    p.disconnect()
+    return fmt.Errorf("the broker did not confirm the event within %s", p.Timeout)
+  case <-ctx.Done():
+    p.disconnect()
+    return ctx.Err()
+  }
+}
+
+func (p *AMQPPublisher) Close() error {
+  p.mutex.Lock()
+  defer p.mutex.Unlock()
+
+  if p.connection == nil {
+    return nil
+  }
+
+  err := p.connection.Close()
+  p.connection = nil
+  p.channel = nil
+
+  return err
+}
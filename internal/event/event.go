@@ -0,0 +1,80 @@
+package event
+
+import (
+  context "context"
+  rand    "crypto/rand"
+  hex     "encoding/hex"
+  json    "encoding/json"
+  log     "github.com/sirupsen/logrus"
+  time    "time"
+)
+
+var eventLog *log.Entry
+
+func init() {
+  eventLog = log.WithFields(log.Fields{
+    "_file": "internal/event/event.go",
+    "_type": "system",
+  })
+}
+
+// Types of the events of the resources lifecycle, also their routing keys
+const (
+  ResourceCreated = "resource.created"
+  ResourceUpdated = "resource.updated"
+  ResourceDeleted = "resource.deleted"
+)
+
+// EnvelopeVersion is the version of the envelope of events; consumers must
+// ignore unknown members and reject unknown versions
+const EnvelopeVersion = 1
+
+// Source identifies the service which emits events
+const Source = "needys-api-resource"
+
+// Event is the envelope of an event, published as JSON
+type Event struct {
+  Version int             `json:"version"`
+  ID      string          `json:"id"`
+  Type    string          `json:"type"`
+  Source  string          `json:"source"`
+  Time    time.Time       `json:"time"`
+  Actor   string          `json:"actor,omitempty"`
+  // CorrelationID is the one of the request which made the change
+  CorrelationID string    `json:"correlation_id,omitempty"`
+  Data    json.RawMessage `json:"data"`
+}
+
+// New wraps data in the envelope of an event of a type
+func New(kind string, data interface{}) (Event, error) {
+  content, err := json.Marshal(data)
+  if err != nil {
+    return Event{}, err
+  }
+
+  return Event{
+    Version: EnvelopeVersion,
+    ID: newID(),
+    Type: kind,
+    Source: Source,
+    Time: time.Now().UTC(),
+    Data: content,
+  }, nil
+}
+
+func newID() string {
+  bytes := make([]byte, 16)
+
+  if _, err := rand.Read(bytes); err != nil {
+    eventLog.Warn("could not generate an event id: ", err)
+  }
+
+  return hex.EncodeToString(bytes)
+}
+
+// Publisher delivers events to their consumers
+type Publisher interface {
+  // Publish returns once the event is delivered, or fails
+  Publish(ctx context.Context, e Event) error
+  Close() error
+}
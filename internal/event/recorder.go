@@ -0,0 +1,52 @@
+package event
+
+import (
+  context "context"
+  sync    "sync"
+)
+
+// Recorder keeps the events published in memory; it stands for the message
+// broker in tests
+type Recorder struct {
+  mutex   sync.RWMutex
+  events  []Event
+  failure error
+}
+
+func NewRecorder() *Recorder {
+  return &Recorder{}
+}
+
+func (r *Recorder) Publish(_ context.Context, e Event) error {
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+
+  if r.failure != nil {
+    return r.failure
+  }
+
+  r.events = append(r.events, e)
+
+  return nil
+}
+
+// Fail makes the next publications fail with err, as a broken broker would,
+// until it is called with nil
+func (r *Recorder) Fail(err error) {
+  r.mutex.Lock()
+  defer r.mutex.Unlock()
+
+  r.failure = err
+}
+
+// Events returns the events published so far, oldest first
+func (r *Recorder) Events() []Event {
+  r.mutex.RLock()
+  defer r.mutex.RUnlock()
+
+  return append([]Event{}, r.events...)
+}
+
+func (r *Recorder) Close() error {
+  return nil
+}
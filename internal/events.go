@@ -0,0 +1,52 @@
+package internal
+
+import (
+  event    "github.com/gpenaud/needys-api-resource/internal/event"
+  log      "github.com/sirupsen/logrus"
+  amqp     "github.com/streadway/amqp"
+  strconv  "strconv"
+  time     "time"
+)
+
+var eventsLog *log.Entry
+
+func init() {
+  eventsLog = log.WithFields(log.Fields{
+    "_file": "internal/events.go",
+    "_type": "system",
+  })
+}
+
+// initializeEvents sets up the publisher the outbox relay delivers the
+// resource lifecycle events to, unless one was injected beforehand; the store
+// only announces changes in the outbox when there is one
+func (a *Application) initializeEvents() {
+  if a.Events == nil && !a.Config.Amqp.Enabled {
+    eventsLog.Info("no message broker is configured, resource events are not published")
+    return
+  }
+
+  if a.Events == nil {
+    port, _ := strconv.Atoi(a.Config.Amqp.Port)
+
+    uri := amqp.URI{
+      Scheme: "amqp",
+      Host: a.Config.Amqp.Host,
+      Port: port,
+      Username: a.Config.Amqp.Username,
+      Password: a.Config.Amqp.Password,
+      Vhost: a.Config.Amqp.VirtualHost,
+    }
+
+    a.Events = event.NewAMQPPublisher(uri.String(), a.Config.Amqp.Exchange,
+      time.Duration(a.Config.Amqp.Timeout) * time.Second)
+
+    eventsLog.WithFields(log.Fields{
+      "amqp_host": a.Config.Amqp.Host,
+      "amqp_port": a.Config.Amqp.Port,
+      "amqp_exchange": a.Config.Amqp.Exchange,
+    }).Info("resource events are published to the message broker")
+  }
+
+  a.Store.EnableOutbox()
+}
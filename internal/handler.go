@@ -1,14 +1,18 @@
 package internal
 
 import (
+  bytes    "bytes"
+  context  "context"
   fmt      "fmt"
   http     "net/http"
+  ioutil   "io/ioutil"
   json     "encoding/json"
+  mime     "mime"
   log       "github.com/sirupsen/logrus"
   resource "github.com/gpenaud/needys-api-resource/internal/resource"
   mux      "github.com/gorilla/mux"
-  sql      "database/sql"
   strconv  "strconv"
+  strings  "strings"
 )
 
 var handlerLog *log.Entry
@@ -27,9 +31,42 @@ func respondHTTPCodeOnly(w http.ResponseWriter, code int) {
   w.WriteHeader(code)
 }
 
-func respondWithError(w http.ResponseWriter, code int, message string) {
-  handlerLog.Error(message)
-  respondWithJSON(w, code, map[string]string{"error": message})
+// respondWithError answers an RFC 7807 problem; the causes of errors are
+// logged with the correlation identifier of the request, never answered
+func respondWithError(w http.ResponseWriter, r *http.Request, err error) {
+  e := asError(err)
+  kind := errorKinds[e.Kind]
+
+  entry := handlerLog.WithFields(log.Fields{
+    "correlation_id": correlationID(r),
+    "status": kind.status,
+  })
+
+  if e.Cause != nil {
+    entry = entry.WithField("error", e.Cause)
+  }
+
+  if kind.status >= http.StatusInternalServerError {
+    entry.Error(e.Detail)
+  } else {
+    entry.Warn(e.Detail)
+  }
+
+  problem := Problem{
+    Type: "/problems/" + kind.slug,
+    Title: kind.title,
+    Status: kind.status,
+    Detail: e.Detail,
+    Instance: r.URL.Path,
+    CorrelationID: correlationID(r),
+    Errors: e.Fields,
+  }
+
+  response, _ := json.Marshal(problem)
+
+  w.Header().Set("Content-Type", "application/problem+json")
+  w.WriteHeader(kind.status)
+  w.Write(response)
 }
 
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
@@ -41,6 +78,55 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
   w.Write(response)
 }
 
+// ActorHeader names who makes a request; it is set by the gateway which
+// authenticates users in front of the service
+const ActorHeader = "X-Actor"
+
+const anonymousActor = "anonymous"
+
+// actor returns who makes a request, recorded by the store on changes
+func actor(r *http.Request) string {
+  if name := strings.TrimSpace(r.Header.Get(ActorHeader)); name != "" {
+    return name
+  }
+
+  return anonymousActor
+}
+
+// changeContext is the context of the changes a request makes to resources,
+// by its actor and with its correlation identifier
+func changeContext(r *http.Request) context.Context {
+  return resource.WithChange(r.Context(), actor(r), correlationID(r))
+}
+
+// -------------------------------------------------------------------------- //
+// Routing handlers
+
+// routeNotFound answers the requests to paths no route matches
+func (a *Application) routeNotFound(w http.ResponseWriter, r *http.Request) {
+  respondWithError(w, r, notFound("No route matches the path " + r.URL.Path))
+}
+
+// methodNotAllowed answers the requests to a path with a method none of its
+// routes accept, listing the ones they do in the Allow header
+func (a *Application) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+  var allowed []string
+
+  for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+    var match mux.RouteMatch
+
+    candidate := r.Clone(r.Context())
+    candidate.Method = method
+
+    if a.Router.Match(candidate, &match) && match.MatchErr == nil {
+      allowed = append(allowed, method)
+    }
+  }
+
+  w.Header().Set("Allow", strings.Join(allowed, ", "))
+  respondWithError(w, r, methodNotAllowed("The method " + r.Method + " is not allowed on the path " + r.URL.Path))
+}
+
 // -------------------------------------------------------------------------- //
 // Probe handlers
 
@@ -57,12 +143,12 @@ func (a *Application) isHealthy(w http.ResponseWriter, _ *http.Request) {
   }
 }
 
-func (a *Application) isReady(w http.ResponseWriter, _ *http.Request) {
+func (a *Application) isReady(w http.ResponseWriter, r *http.Request) {
   if a.Config.LogHealthcheck {
     handlerLog.Debug("sent a GET request on /ready")
 
     if err := a.isDatabaseReachable(); err != nil {
-      respondWithError(w, http.StatusInternalServerError, "database is not available")
+      respondWithError(w, r, unavailable("The database is not available", err))
     } else {
       payload := map[string]interface{}{
         "ready": true,
@@ -72,7 +158,7 @@ func (a *Application) isReady(w http.ResponseWriter, _ *http.Request) {
     }
   } else {
     if err := a.isDatabaseReachable(); err != nil {
-      respondHTTPCodeOnly(w, http.StatusInternalServerError)
+      respondHTTPCodeOnly(w, http.StatusServiceUnavailable)
     } else {
       respondHTTPCodeOnly(w, http.StatusOK)
     }
@@ -80,66 +166,292 @@ func (a *Application) isReady(w http.ResponseWriter, _ *http.Request) {
 }
 
 // -------------------------------------------------------------------------- //
-// Maintenance handlers
+// Resource handlers
 
-const dbInitQuery = `
-  CREATE TABLE IF NOT EXISTS resources (
-    id SERIAL,
-    type TEXT NOT NULL,
-    description TEXT NOT NULL,
-    CONSTRAINT resources_pkey PRIMARY KEY (id)
-  );
+// MaxPayloadSize is the largest body accepted to create, replace or patch a
+// resource, in bytes
+const MaxPayloadSize = 1 << 20
 
-  DELETE FROM resources;
-  ALTER SEQUENCE resources_id_seq RESTART WITH 1;
+// readPayload reads the body of a request, up to MaxPayloadSize; it responds
+// with the error and returns false when the body is too large or unreadable
+func readPayload(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+  defer r.Body.Close()
 
-  INSERT INTO resources(type, description) VALUES('individual', 'faire une sieste') RETURNING id;
-  INSERT INTO resources(type, description) VALUES('collective', 'faire une séance de biodanza') RETURNING id;
-  `
+  content, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxPayloadSize))
 
-func (a *Application) InitializeDB(w http.ResponseWriter, _ *http.Request) {
-  var err error
+  // MaxBytesReader fails once the limit is read and more follows
+  if err != nil && len(content) == MaxPayloadSize {
+    respondWithError(w, r, payloadTooLarge(fmt.Sprintf("The payload must be at most %d bytes", MaxPayloadSize)))
+    return nil, false
+  }
 
-  if err = a.isDatabaseReachable(); err != nil {
-    respondWithError(w, http.StatusInternalServerError, "Database is not available")
-  } else {
-    if _, err = a.DB.Exec(dbInitQuery); err == nil {
-      payload := map[string]bool{
-        "initialized": true,
-      }
-      respondWithJSON(w, http.StatusOK, payload)
-    } else {
-      respondWithError(w, http.StatusInternalServerError, "Database is not initializable")
-    }
+  if err != nil {
+    respondWithError(w, r, badRequest("The payload cannot be read"))
+    return nil, false
   }
+
+  return content, true
 }
 
-// -------------------------------------------------------------------------- //
-// Resource handlers
+// decodeValidResource reads and validates the resource sent in the body; it
+// responds with the error and returns false when the resource is invalid
+func decodeValidResource(w http.ResponseWriter, r *http.Request) (resource.Resource, bool) {
+  content, ok := readPayload(w, r)
+  if !ok {
+    return resource.Resource{}, false
+  }
+
+  res, err := resource.DecodePayload(bytes.NewReader(content))
 
+  if err == resource.ErrMalformedPayload {
+    respondWithError(w, r, badRequest("The payload is not a valid JSON object"))
+    return res, false
+  }
+
+  if err != nil {
+    respondWithError(w, r, err)
+    return res, false
+  }
+
+  return res, true
+}
+
+// getResources returns a page of resources in an envelope, with opaque
+// cursors to the neighbour pages, optionally filtered and sorted (e.g.
+// ?sort=type,-id); the legacy start/count parameters still return a bare list.
 func (a *Application) getResources(w http.ResponseWriter, r *http.Request) {
   handlerLog.Info("sent a GET query on /resources")
 
+  if r.FormValue("start") != "" || r.FormValue("count") != "" {
+    a.getResourcesFromOffset(w, r)
+    return
+  }
+
+  a.listResources(w, r, resource.Query{})
+}
+
+// getTrashedResources returns a page of the deleted resources which can still
+// be restored, with the parameters of getResources
+func (a *Application) getTrashedResources(w http.ResponseWriter, r *http.Request) {
+  handlerLog.Info("sent a GET query on /resources/trash")
+
+  a.listResources(w, r, resource.Query{Deleted: true})
+}
+
+// listResources answers a page of the resources query selects, narrowed by
+// the parameters of getResources
+func (a *Application) listResources(w http.ResponseWriter, r *http.Request, query resource.Query) {
+  query.Limit = a.Config.Pagination.DefaultPageSize
+
+  if limit := r.FormValue("limit"); limit != "" {
+    var err error
+
+    query.Limit, err = strconv.Atoi(limit)
+    if err != nil || query.Limit < 1 || query.Limit > a.Config.Pagination.MaxPageSize {
+      respondWithError(w, r,
+        badRequest(fmt.Sprintf("The limit must be between 1 and %d", a.Config.Pagination.MaxPageSize)))
+      return
+    }
+  }
+
+  if sort := r.FormValue("sort"); sort != "" {
+    var err error
+
+    if query.Sort, err = resource.ParseSort(sort); err != nil {
+      respondWithError(w, r, badRequest(err.Error()))
+      return
+    }
+  }
+
+  if cursor := r.FormValue("cursor"); cursor != "" {
+    var err error
+
+    if query.Cursor, err = resource.DecodeCursor(cursor, query.Sort); err != nil {
+      respondWithError(w, r, badRequest("The cursor is invalid"))
+      return
+    }
+  }
+
+  var err error
+
+  if query.Filter, err = resourcesFilter(r); err != nil {
+    respondWithError(w, r, badRequest(err.Error()))
+    return
+  }
+
+  if query.IncludeTotal, err = includeTotal(r); err != nil {
+    respondWithError(w, r, badRequest("The include_total parameter must be a boolean"))
+    return
+  }
+
+  page, err := a.Store.ListResources(query)
+  if err != nil {
+    respondWithError(w, r, err)
+    return
+  }
+
+  if page.Total != nil {
+    w.Header().Set("X-Total-Count", strconv.Itoa(*page.Total))
+  }
+
+  w.Header().Set("Link", paginationLinks(r, page))
+
+  respondWithJSON(w, http.StatusOK, page)
+}
+
+// resourcesFilter reads the filter expression of a listing, e.g.
+// ?filter=type in (individual, collective) and id >= 2, the type shorthand,
+// e.g. ?type=individual or ?type=individual,collective, and the updated_since
+// shorthand, e.g. ?updated_since=2021-06-01T00:00:00Z
+func resourcesFilter(r *http.Request) (resource.Filter, error) {
+  filter := resource.Filter{}
+
+  if expression := r.FormValue("filter"); expression != "" {
+    var err error
+
+    if filter, err = resource.ParseFilter(expression); err != nil {
+      return nil, err
+    }
+  }
+
+  if types := r.FormValue("type"); types != "" {
+    operator := "="
+    values := strings.Split(types, ",")
+
+    if len(values) > 1 {
+      operator = "in"
+    }
+
+    condition, err := resource.NewCondition("type", operator, values)
+    if err != nil {
+      return nil, err
+    }
+
+    filter = append(filter, condition)
+  }
+
+  if since := r.FormValue("updated_since"); since != "" {
+    condition, err := resource.NewCondition("updated_at", ">=", []string{since})
+    if err != nil {
+      return nil, err
+    }
+
+    filter = append(filter, condition)
+  }
+
+  return filter, nil
+}
+
+// includeTotal reads the include_total parameter, true by default
+func includeTotal(r *http.Request) (bool, error) {
+  if value := r.FormValue("include_total"); value != "" {
+    return strconv.ParseBool(value)
+  }
+
+  return true, nil
+}
+
+// paginationLinks returns the RFC 8288 Link header value pointing to the
+// first, previous, next and last pages of a listing
+func paginationLinks(r *http.Request, page resource.Page) string {
+  link := func(rel, cursor string) string {
+    u := *r.URL
+    values := u.Query()
+
+    if cursor == "" {
+      values.Del("cursor")
+    } else {
+      values.Set("cursor", cursor)
+    }
+
+    u.RawQuery = values.Encode()
+
+    return fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel)
+  }
+
+  links := []string{link("first", "")}
+
+  if page.PrevCursor != "" {
+    links = append(links, link("prev", page.PrevCursor))
+  }
+
+  if page.NextCursor != "" {
+    links = append(links, link("next", page.NextCursor))
+  }
+
+  links = append(links, link("last", resource.LastCursor.Encode()))
+
+  return strings.Join(links, ", ")
+}
+
+func (a *Application) getResourcesFromOffset(w http.ResponseWriter, r *http.Request) {
   count, _ := strconv.Atoi(r.FormValue("count"))
   start, _ := strconv.Atoi(r.FormValue("start"))
 
-  if count > 10 || count < 1 {
-    count = 10
+  if count > a.Config.Pagination.MaxPageSize || count < 1 {
+    count = a.Config.Pagination.DefaultPageSize
   }
 
   if start < 0 {
     start = 0
   }
 
-  products, err := resource.GetResources(a.DB, start, count)
+  withTotal, err := includeTotal(r)
   if err != nil {
-    respondWithError(w, http.StatusInternalServerError, err.Error())
+    respondWithError(w, r, badRequest("The include_total parameter must be a boolean"))
     return
   }
 
+  products, err := a.Store.GetResources(start, count)
+  if err != nil {
+    respondWithError(w, r, err)
+    return
+  }
+
+  if withTotal {
+    total, err := a.Store.CountResources()
+    if err != nil {
+      respondWithError(w, r, err)
+      return
+    }
+
+    w.Header().Set("X-Total-Count", strconv.Itoa(total))
+  }
+
   respondWithJSON(w, http.StatusOK, products)
 }
 
+func (a *Application) searchResources(w http.ResponseWriter, r *http.Request) {
+  handlerLog.WithFields(log.Fields{
+    "parameter_q": r.FormValue("q"),
+  }).Info("sent a GET query on /resources/search")
+
+  limit := a.Config.Pagination.DefaultPageSize
+
+  if value := r.FormValue("limit"); value != "" {
+    var err error
+
+    limit, err = strconv.Atoi(value)
+    if err != nil || limit < 1 || limit > a.Config.Pagination.MaxPageSize {
+      respondWithError(w, r,
+        badRequest(fmt.Sprintf("The limit must be between 1 and %d", a.Config.Pagination.MaxPageSize)))
+      return
+    }
+  }
+
+  results, err := a.Store.SearchResources(r.FormValue("q"), limit)
+  if err != nil {
+    if err == resource.ErrEmptySearch {
+      err = badRequest("The q parameter must contain words to search")
+    }
+
+    respondWithError(w, r, err)
+    return
+  }
+
+  respondWithJSON(w, http.StatusOK, map[string]interface{}{"items": results})
+}
+
 func (a *Application) getResource(w http.ResponseWriter, r *http.Request) {
   vars := mux.Vars(r)
 
@@ -149,48 +461,55 @@ func (a *Application) getResource(w http.ResponseWriter, r *http.Request) {
 
   id, err := strconv.Atoi(vars["id"])
   if err != nil {
-    respondWithError(w, http.StatusBadRequest, fmt.Sprintf("The resource with ID %d is invalid", id))
+    respondWithError(w, r, badRequest("The resource ID is invalid"))
     return
   }
 
-  resource := resource.Resource{ID: id}
+  res := resource.Resource{ID: id}
 
-  err = resource.GetResource(a.DB)
+  err = a.Store.GetResource(&res)
   if err != nil {
-    switch err {
-    case sql.ErrNoRows:
-      respondWithError(w, http.StatusNotFound, fmt.Sprintf("The resource with ID %d is not found", id))
-    default:
-      respondWithError(w, http.StatusInternalServerError, err.Error())
+    if err == resource.ErrNotFound {
+      err = notFound(fmt.Sprintf("The resource with ID %d is not found", id))
     }
+
+    respondWithError(w, r, err)
     return
   }
 
-  respondWithJSON(w, http.StatusOK, resource)
+  tag := etag(res.Version)
+  w.Header().Set("ETag", tag)
+
+  if notModified(r, tag) {
+    respondHTTPCodeOnly(w, http.StatusNotModified)
+    return
+  }
+
+  respondWithJSON(w, http.StatusOK, res)
 }
 
 func (a *Application) createResource(w http.ResponseWriter, r *http.Request) {
   handlerLog.Info("sent a POST query on /resource to create a new resource")
 
-  var resource resource.Resource
+  res, valid := decodeValidResource(w, r)
+  if !valid {
+    return
+  }
 
-  decoder := json.NewDecoder(r.Body)
-  err := decoder.Decode(&resource)
 
-  if err != nil {
-    respondWithError(w, http.StatusBadRequest, "The payload is invalid")
+  if err := a.checkNeeds(r.Context(), res.Needs); err != nil {
+    respondWithError(w, r, err)
     return
   }
 
-  defer r.Body.Close()
-
-  err = resource.CreateResource(a.DB)
+  err := a.Store.CreateResource(changeContext(r), &res)
   if err != nil {
-    respondWithError(w, http.StatusInternalServerError, err.Error())
+    respondWithError(w, r, err)
     return
   }
 
-  respondWithJSON(w, http.StatusCreated, resource)
+  w.Header().Set("ETag", etag(res.Version))
+  respondWithJSON(w, http.StatusCreated, res)
 }
 
 func (a *Application) updateResource(w http.ResponseWriter, r *http.Request) {
@@ -202,30 +521,105 @@ func (a *Application) updateResource(w http.ResponseWriter, r *http.Request) {
 
   id, err := strconv.Atoi(vars["id"])
   if err != nil {
-    respondWithError(w, http.StatusBadRequest, "The resource ID is invalid")
+    respondWithError(w, r, badRequest("The resource ID is invalid"))
+    return
+  }
+
+  res, valid := decodeValidResource(w, r)
+  if !valid {
     return
   }
 
-  var resource resource.Resource
-  decoder := json.NewDecoder(r.Body)
+  res.ID = id
 
-  err = decoder.Decode(&resource)
+  if res.Version, err = a.expectedVersion(r, id); err != nil {
+    respondWithError(w, r, err)
+    return
+  }
+
+  if err = a.checkNeeds(r.Context(), res.Needs); err != nil {
+    respondWithError(w, r, err)
+    return
+  }
+
+  err = a.Store.UpdateResource(changeContext(r), &res)
   if err != nil {
-    respondWithError(w, http.StatusBadRequest, "The payload is invalid")
+    if err == resource.ErrNotFound {
+      err = notFound(fmt.Sprintf("The resource with ID %d is not found", id))
+    }
+
+    respondWithError(w, r, err)
     return
   }
 
-  defer r.Body.Close()
+  w.Header().Set("ETag", etag(res.Version))
+  respondWithJSON(w, http.StatusOK, res)
+}
+
+// acceptedPatches is advertised by the Accept-Patch header (RFC 5789)
+var acceptedPatches = strings.Join(
+  []string{resource.MergePatchContentType, resource.JSONPatchContentType}, ", ")
+
+func (a *Application) patchResource(w http.ResponseWriter, r *http.Request) {
+  vars := mux.Vars(r)
+
+  handlerLog.WithFields(log.Fields{
+    "parameter_id": vars["id"],
+  }).Info("sent a PATCH query on /resource/{id} to partially update the resource")
+
+  id, err := strconv.Atoi(vars["id"])
+  if err != nil {
+    respondWithError(w, r, badRequest("The resource ID is invalid"))
+    return
+  }
+
+  content, ok := readPayload(w, r)
+  if !ok {
+    return
+  }
+
+  mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+  patch, err := resource.ParsePatch(mediaType, bytes.NewReader(content))
+  if err == resource.ErrUnsupportedPatch {
+    w.Header().Set("Accept-Patch", acceptedPatches)
+    respondWithError(w, r, unsupportedMediaType("The patch must be one of " + acceptedPatches))
+    return
+  }
+
+  if err == resource.ErrMalformedPatch {
+    respondWithError(w, r, badRequest("The patch document is not valid JSON"))
+    return
+  }
+
+  if err != nil {
+    respondWithError(w, r, err)
+    return
+  }
 
-  resource.ID = id
+  res := resource.Resource{ID: id}
+
+  if res.Version, err = a.expectedVersion(r, id); err != nil {
+    respondWithError(w, r, err)
+    return
+  }
+
+  err = a.patchCheckingNeeds(changeContext(r), &res, patch)
 
-  err = resource.UpdateResource(a.DB)
   if err != nil {
-    respondWithError(w, http.StatusInternalServerError, err.Error())
+    switch err {
+    case resource.ErrNotFound:
+      err = notFound(fmt.Sprintf("The resource with ID %d is not found", id))
+    case resource.ErrPatchTestFailed:
+      err = conflict("A test operation of the patch failed")
+    }
+
+    respondWithError(w, r, err)
     return
   }
 
-  respondWithJSON(w, http.StatusOK, resource)
+  w.Header().Set("ETag", etag(res.Version))
+  respondWithJSON(w, http.StatusOK, res)
 }
 
 func (a *Application) deleteResource(w http.ResponseWriter, r *http.Request) {
@@ -237,17 +631,306 @@ func (a *Application) deleteResource(w http.ResponseWriter, r *http.Request) {
 
   id, err := strconv.Atoi(vars["id"])
   if err != nil {
-    respondWithError(w, http.StatusBadRequest, "The resource ID is invalid")
+    respondWithError(w, r, badRequest("The resource ID is invalid"))
     return
   }
 
-  resource := resource.Resource{ID: id}
+  res := resource.Resource{ID: id}
+
+  if res.Version, err = a.expectedVersion(r, id); err != nil {
+    respondWithError(w, r, err)
+    return
+  }
 
-  err = resource.DeleteResource(a.DB)
+  err = a.Store.DeleteResource(changeContext(r), &res)
   if err != nil {
-    respondWithError(w, http.StatusInternalServerError, err.Error())
+    if err == resource.ErrNotFound {
+      err = notFound(fmt.Sprintf("The resource with ID %d is not found", id))
+    }
+
+    respondWithError(w, r, err)
     return
   }
 
   respondWithJSON(w, http.StatusOK, map[string]string{"result": "success"})
 }
+
+func (a *Application) restoreResource(w http.ResponseWriter, r *http.Request) {
+  vars := mux.Vars(r)
+
+  handlerLog.WithFields(log.Fields{
+    "parameter_id": vars["id"],
+  }).Info("sent a POST query on /resource/{id}/restore to bring the resource back from the trash")
+
+  id, err := strconv.Atoi(vars["id"])
+  if err != nil {
+    respondWithError(w, r, badRequest("The resource ID is invalid"))
+    return
+  }
+
+  res := resource.Resource{ID: id}
+
+  if res.Version, err = a.expectedTrashedVersion(r, id); err != nil {
+    if err == resource.ErrNotFound {
+      err = notFound(fmt.Sprintf("The resource with ID %d is not in the trash", id))
+    }
+
+    respondWithError(w, r, err)
+    return
+  }
+
+  err = a.Store.RestoreResource(changeContext(r), &res)
+  if err != nil {
+    if err == resource.ErrNotFound {
+      err = notFound(fmt.Sprintf("The resource with ID %d is not in the trash", id))
+    }
+
+    respondWithError(w, r, err)
+    return
+  }
+
+  w.Header().Set("ETag", etag(res.Version))
+  respondWithJSON(w, http.StatusOK, res)
+}
+
+// -------------------------------------------------------------------------- //
+// Resource history handlers
+
+func (a *Application) getResourceHistory(w http.ResponseWriter, r *http.Request) {
+  vars := mux.Vars(r)
+
+  handlerLog.WithFields(log.Fields{
+    "parameter_id": vars["id"],
+  }).Info("sent a GET query on /resource/{id}/history")
+
+  id, err := strconv.Atoi(vars["id"])
+  if err != nil {
+    respondWithError(w, r, badRequest("The resource ID is invalid"))
+    return
+  }
+
+  revisions, err := a.Store.ListRevisions(id)
+  if err != nil {
+    if err == resource.ErrNotFound {
+      err = notFound(fmt.Sprintf("The resource with ID %d has no history", id))
+    }
+
+    respondWithError(w, r, err)
+    return
+  }
+
+  respondWithJSON(w, http.StatusOK, map[string]interface{}{"items": revisions})
+}
+
+// revisionVars reads the resource ID and the revision of a history route
+func revisionVars(r *http.Request) (int, int, error) {
+  vars := mux.Vars(r)
+
+  id, err := strconv.Atoi(vars["id"])
+  if err != nil {
+    return 0, 0, badRequest("The resource ID is invalid")
+  }
+
+  revision, err := strconv.Atoi(vars["revision"])
+  if err != nil {
+    return 0, 0, badRequest("The revision is invalid")
+  }
+
+  return id, revision, nil
+}
+
+// revisionError details the not found errors of a revision
+func revisionError(err error, id, revision int) error {
+  switch err {
+  case resource.ErrNotFound:
+    return notFound(fmt.Sprintf("The resource with ID %d is not found", id))
+  case resource.ErrRevisionNotFound:
+    return notFound(fmt.Sprintf("The resource with ID %d has no revision %d", id, revision))
+  default:
+    return err
+  }
+}
+
+func (a *Application) getResourceRevision(w http.ResponseWriter, r *http.Request) {
+  vars := mux.Vars(r)
+
+  handlerLog.WithFields(log.Fields{
+    "parameter_id": vars["id"],
+    "parameter_revision": vars["revision"],
+  }).Info("sent a GET query on /resource/{id}/history/{revision}")
+
+  id, revision, err := revisionVars(r)
+  if err != nil {
+    respondWithError(w, r, err)
+    return
+  }
+
+  rev, err := a.Store.GetRevision(id, revision)
+  if err != nil {
+    respondWithError(w, r, revisionError(err, id, revision))
+    return
+  }
+
+  respondWithJSON(w, http.StatusOK, rev)
+}
+
+func (a *Application) revertResource(w http.ResponseWriter, r *http.Request) {
+  vars := mux.Vars(r)
+
+  handlerLog.WithFields(log.Fields{
+    "parameter_id": vars["id"],
+    "parameter_revision": vars["revision"],
+  }).Info("sent a POST query on /resource/{id}/history/{revision}/revert to revert the resource")
+
+  id, revision, err := revisionVars(r)
+  if err != nil {
+    respondWithError(w, r, err)
+    return
+  }
+
+  res := resource.Resource{ID: id}
+
+  if res.Version, err = a.expectedVersion(r, id); err != nil {
+    respondWithError(w, r, err)
+    return
+  }
+
+  if err = a.Store.RevertResource(changeContext(r), &res, revision); err != nil {
+    respondWithError(w, r, revisionError(err, id, revision))
+    return
+  }
+
+  w.Header().Set("ETag", etag(res.Version))
+  respondWithJSON(w, http.StatusOK, res)
+}
+
+// -------------------------------------------------------------------------- //
+// Resource needs handlers
+
+// needVars reads the resource ID and the need ID of a need route
+func needVars(r *http.Request) (int, int, error) {
+  vars := mux.Vars(r)
+
+  id, err := strconv.Atoi(vars["id"])
+  if err != nil {
+    return 0, 0, badRequest("The resource ID is invalid")
+  }
+
+  need, err := strconv.Atoi(vars["need"])
+  if err != nil || need < 1 {
+    return 0, 0, badRequest("The need ID is invalid")
+  }
+
+  return id, need, nil
+}
+
+// attachNeed links a resource to a need which exists in the need service;
+// linking it again leaves it as is
+func (a *Application) attachNeed(w http.ResponseWriter, r *http.Request) {
+  vars := mux.Vars(r)
+
+  handlerLog.WithFields(log.Fields{
+    "parameter_id": vars["id"],
+    "parameter_need": vars["need"],
+  }).Info("sent a PUT query on /resource/{id}/need/{need} to link the resource to the need")
+
+  id, need, err := needVars(r)
+  if err != nil {
+    respondWithError(w, r, err)
+    return
+  }
+
+  res := resource.Resource{ID: id}
+
+  if res.Version, err = a.expectedVersion(r, id); err != nil {
+    respondWithError(w, r, err)
+    return
+  }
+
+  // the need is checked before the store holds the resource
+  if err = a.checkNeeds(r.Context(), []int{need}); err != nil {
+    respondWithError(w, r, err)
+    return
+  }
+
+  err = a.Store.PatchResource(changeContext(r), &res, func(current *resource.Resource) error {
+    if !current.AttachNeed(need) {
+      return resource.ErrNoChange
+    }
+
+    return current.Validate()
+  })
+
+  if err != nil {
+    if err == resource.ErrNotFound {
+      err = notFound(fmt.Sprintf("The resource with ID %d is not found", id))
+    }
+
+    respondWithError(w, r, err)
+    return
+  }
+
+  w.Header().Set("ETag", etag(res.Version))
+  respondWithJSON(w, http.StatusOK, res)
+}
+
+// detachNeed unlinks a resource from a need
+func (a *Application) detachNeed(w http.ResponseWriter, r *http.Request) {
+  vars := mux.Vars(r)
+
+  handlerLog.WithFields(log.Fields{
+    "parameter_id": vars["id"],
+    "parameter_need": vars["need"],
+  }).Info("sent a DELETE query on /resource/{id}/need/{need} to unlink the resource from the need")
+
+  id, need, err := needVars(r)
+  if err != nil {
+    respondWithError(w, r, err)
+    return
+  }
+
+  res := resource.Resource{ID: id}
+
+  if res.Version, err = a.expectedVersion(r, id); err != nil {
+    respondWithError(w, r, err)
+    return
+  }
+
+  err = a.Store.PatchResource(changeContext(r), &res, func(current *resource.Resource) error {
+    if !current.DetachNeed(need) {
+      return notFound(fmt.Sprintf("The resource with ID %d is not linked to the need %d", id, need))
+    }
+
+    return nil
+  })
+
+  if err != nil {
+    if err == resource.ErrNotFound {
+      err = notFound(fmt.Sprintf("The resource with ID %d is not found", id))
+    }
+
+    respondWithError(w, r, err)
+    return
+  }
+
+  w.Header().Set("ETag", etag(res.Version))
+  respondWithJSON(w, http.StatusOK, res)
+}
+
+// getNeedResources returns a page of the resources linked to a need, with
+// the parameters of getResources
+func (a *Application) getNeedResources(w http.ResponseWriter, r *http.Request) {
+  vars := mux.Vars(r)
+
+  handlerLog.WithFields(log.Fields{
+    "parameter_need": vars["need"],
+  }).Info("sent a GET query on /need/{need}/resources")
+
+  need, err := strconv.Atoi(vars["need"])
+  if err != nil || need < 1 {
+    respondWithError(w, r, badRequest("The need ID is invalid"))
+    return
+  }
+
+  a.listResources(w, r, resource.Query{Need: need})
+}
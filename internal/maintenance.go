@@ -0,0 +1,142 @@
+package internal
+
+import (
+  json     "encoding/json"
+  http     "net/http"
+  log      "github.com/sirupsen/logrus"
+  resource "github.com/gpenaud/needys-api-resource/internal/resource"
+  strings  "strings"
+  subtle   "crypto/subtle"
+)
+
+var maintenanceLog *log.Entry
+
+func init() {
+  maintenanceLog = log.WithFields(log.Fields{
+    "_file": "internal/maintenance.go",
+    "_type": "system",
+  })
+}
+
+// MaintenanceConfirmation must be sent as "confirmation" in the body of a
+// maintenance query which is not a dry-run
+const MaintenanceConfirmation = "wipe-all-resources"
+
+type maintenanceRequest struct {
+  Confirmation string `json:"confirmation"`
+  DryRun       bool   `json:"dry_run"`
+}
+
+// maintenanceAllowed reports whether destructive maintenance routes may be used
+// in the current environment
+func (a *Application) maintenanceAllowed() bool {
+  switch a.Config.Environment {
+  case "development", "integration":
+    return a.Config.Maintenance.Token != ""
+  default:
+    return false
+  }
+}
+
+func (a *Application) isMaintenanceAuthorized(r *http.Request) bool {
+  header := r.Header.Get("Authorization")
+
+  if !strings.HasPrefix(header, "Bearer ") {
+    return false
+  }
+
+  token := strings.TrimPrefix(header, "Bearer ")
+
+  return subtle.ConstantTimeCompare([]byte(token), []byte(a.Config.Maintenance.Token)) == 1
+}
+
+// countAllResources counts the resources a wipe deletes, the live ones and
+// the ones in the trash
+func (a *Application) countAllResources() (int, error) {
+  live, err := a.Store.CountResources()
+  if err != nil {
+    return 0, err
+  }
+
+  trash, err := a.Store.ListResources(resource.Query{Limit: 1, IncludeTotal: true, Deleted: true})
+  if err != nil {
+    return 0, err
+  }
+
+  return live + *trash.Total, nil
+}
+
+// InitializeDB wipes every resource and reseeds the defaults. It is only
+// available in development and integration environments, to an admin sending
+// the maintenance token and the explicit confirmation; a dry-run reports what
+// would be deleted without touching anything.
+func (a *Application) InitializeDB(w http.ResponseWriter, r *http.Request) {
+  maintenanceLog.WithFields(log.Fields{
+    "remote_address": r.RemoteAddr,
+  }).Warn("sent a POST query on /initialize_db")
+
+  if !a.maintenanceAllowed() {
+    respondWithError(w, r, forbidden("Maintenance is disabled in this environment"))
+    return
+  }
+
+  if !a.isMaintenanceAuthorized(r) {
+    w.Header().Set("WWW-Authenticate", `Bearer realm="maintenance"`)
+    respondWithError(w, r, unauthorized("A valid maintenance token is required"))
+    return
+  }
+
+  var request maintenanceRequest
+
+  if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+    respondWithError(w, r, badRequest("The payload is invalid"))
+    return
+  }
+
+  defer r.Body.Close()
+
+  if err := a.isDatabaseReachable(); err != nil {
+    respondWithError(w, r, unavailable("The database is not available", err))
+    return
+  }
+
+  count, err := a.countAllResources()
+  if err != nil {
+    respondWithError(w, r, err)
+    return
+  }
+
+  if request.DryRun {
+    payload := map[string]interface{}{
+      "dry_run": true,
+      "deleted": count,
+      "seeded": len(resource.Seeds),
+    }
+
+    respondWithJSON(w, http.StatusOK, payload)
+    return
+  }
+
+  if request.Confirmation != MaintenanceConfirmation {
+    respondWithError(w, r, badRequest("The confirmation is missing or invalid"))
+    return
+  }
+
+  if err = a.Store.Initialize(); err != nil {
+    respondWithError(w, r, err)
+    return
+  }
+
+  maintenanceLog.WithFields(log.Fields{
+    "deleted": count,
+    "seeded": len(resource.Seeds),
+  }).Warn("database has been initialized")
+
+  payload := map[string]interface{}{
+    "initialized": true,
+    "deleted": count,
+    "seeded": len(resource.Seeds),
+  }
+
+  respondWithJSON(w, http.StatusOK, payload)
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+  fmt       "fmt"
+  log       "github.com/sirupsen/logrus"
+  migration "github.com/gpenaud/needys-api-resource/internal/migration"
+  os        "os"
+  strconv   "strconv"
+  tabwriter "text/tabwriter"
+)
+
+var migrateLog *log.Entry
+
+func init() {
+  migrateLog = log.WithFields(log.Fields{
+    "_file": "internal/migrate.go",
+    "_type": "system",
+  })
+}
+
+const migrateUsage = "usage: migrate up [VERSION] | down [STEPS] | status | verify"
+
+// Migrate runs the "migrate" command: up applies pending migrations (up to
+// VERSION), down reverts the last STEPS migrations (1 by default), status
+// lists migrations and verify checks the applied ones were not modified.
+func (a *Application) Migrate(args []string) error {
+  a.initializeLogger()
+
+  if len(args) == 0 || len(args) > 2 {
+    return fmt.Errorf(migrateUsage)
+  }
+
+  number := 0
+
+  if len(args) == 2 {
+    var err error
+    if number, err = strconv.Atoi(args[1]); err != nil || number < 0 {
+      return fmt.Errorf("invalid number %q, %s", args[1], migrateUsage)
+    }
+  }
+
+  db, err := a.openDatabase()
+  if err != nil {
+    return err
+  }
+
+  defer db.Close()
+
+  if err = a.waitForDatabase(db); err != nil {
+    return err
+  }
+
+  migrator := migration.New(db)
+
+  switch args[0] {
+  case "up":
+    err = migrator.Up(number)
+  case "down":
+    if number == 0 {
+      number = 1
+    }
+    err = migrator.Down(number)
+  case "status":
+    err = printMigrationStatus(migrator)
+  case "verify":
+    err = migrator.Verify()
+  default:
+    return fmt.Errorf("unknown migrate command %q, %s", args[0], migrateUsage)
+  }
+
+  if err == nil {
+    migrateLog.WithFields(log.Fields{
+      "command": args[0],
+    }).Info("migrate command succeeded")
+  }
+
+  return err
+}
+
+func printMigrationStatus(migrator *migration.Migrator) error {
+  statuses, err := migrator.Status()
+  if err != nil {
+    return err
+  }
+
+  w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+  fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+
+  for _, s := range statuses {
+    status := "pending"
+    appliedAt := "-"
+
+    if s.Applied {
+      status = "applied"
+      appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+    }
+
+    if s.Modified() {
+      status = "modified"
+    }
+
+    fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
+  }
+
+  return w.Flush()
+}
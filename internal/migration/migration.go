@@ -0,0 +1,291 @@
+package migration
+
+import (
+  context "context"
+  fmt     "fmt"
+  hex     "encoding/hex"
+  log     "github.com/sirupsen/logrus"
+  sha256  "crypto/sha256"
+  sort    "sort"
+  sql     "database/sql"
+  time    "time"
+)
+
+var migrationLog *log.Entry
+
+func init() {
+  migrationLog = log.WithFields(log.Fields{
+    "_file": "internal/migration/migration.go",
+    "_type": "system",
+  })
+}
+
+// Migration is one versioned, reversible step of the database schema
+type Migration struct {
+  Version int
+  Name    string
+  Up      string
+  Down    string
+}
+
+// Checksum identifies the content of a migration, so that an already applied
+// migration which has been edited afterwards can be detected
+func (m Migration) Checksum() string {
+  sum := sha256.Sum256([]byte(m.Up + "\n--\n" + m.Down))
+  return hex.EncodeToString(sum[:])
+}
+
+type Status struct {
+  Migration
+  Applied   bool
+  AppliedAt time.Time
+  // Checksum recorded when the migration was applied, empty if not applied
+  AppliedChecksum string
+}
+
+func (s Status) Modified() bool {
+  return s.Applied && s.AppliedChecksum != s.Checksum()
+}
+
+type Migrator struct {
+  DB         *sql.DB
+  Migrations []Migration
+}
+
+// New returns a migrator over the migrations embedded in the binary
+func New(db *sql.DB) *Migrator {
+  return &Migrator{DB: db, Migrations: Migrations}
+}
+
+const schemaMigrationsQuery = `
+  CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    checksum TEXT NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CONSTRAINT schema_migrations_pkey PRIMARY KEY (version)
+  );
+  `
+
+// an arbitrary key serializing concurrent migrators on the same database
+const advisoryLockKey = 4242017
+
+// locked runs change on a connection of its own, holding the advisory lock
+// for the whole session, so concurrent migrators run one after the other and
+// each sees what the previous one applied
+func (m *Migrator) locked(change func(conn *sql.Conn) error) error {
+  ctx := context.Background()
+
+  conn, err := m.DB.Conn(ctx)
+  if err != nil {
+    return err
+  }
+
+  defer conn.Close()
+
+  if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", advisoryLockKey); err != nil {
+    return err
+  }
+
+  defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", advisoryLockKey)
+
+  return change(conn)
+}
+
+func (m *Migrator) sorted() []Migration {
+  migrations := make([]Migration, len(m.Migrations))
+  copy(migrations, m.Migrations)
+
+  sort.Slice(migrations, func(i, j int) bool {
+    return migrations[i].Version < migrations[j].Version
+  })
+
+  return migrations
+}
+
+// Status reads which migrations are applied, under the lock, so it never sees
+// a migration half applied by another migrator
+func (m *Migrator) Status() ([]Status, error) {
+  var statuses []Status
+
+  err := m.locked(func(conn *sql.Conn) error {
+    var err error
+
+    statuses, err = m.status(conn)
+    return err
+  })
+
+  return statuses, err
+}
+
+func (m *Migrator) status(conn *sql.Conn) ([]Status, error) {
+  ctx := context.Background()
+
+  if _, err := conn.ExecContext(ctx, schemaMigrationsQuery); err != nil {
+    return nil, err
+  }
+
+  rows, err := conn.QueryContext(ctx, "SELECT version, checksum, applied_at FROM schema_migrations")
+  if err != nil {
+    return nil, err
+  }
+
+  defer rows.Close()
+
+  applied := make(map[int]Status)
+
+  for rows.Next() {
+    var s Status
+    if err := rows.Scan(&s.Version, &s.AppliedChecksum, &s.AppliedAt); err != nil {
+      return nil, err
+    }
+    s.Applied = true
+    applied[s.Version] = s
+  }
+
+  if err := rows.Err(); err != nil {
+    return nil, err
+  }
+
+  statuses := []Status{}
+
+  for _, migration := range m.sorted() {
+    s := applied[migration.Version]
+    s.Migration = migration
+    statuses = append(statuses, s)
+
+    delete(applied, migration.Version)
+  }
+
+  for version := range applied {
+    return nil, fmt.Errorf("migration %d is applied but unknown to this binary", version)
+  }
+
+  return statuses, nil
+}
+
+// Verify fails if an applied migration differs from the embedded one
+func (m *Migrator) Verify() error {
+  statuses, err := m.Status()
+  if err != nil {
+    return err
+  }
+
+  return verify(statuses)
+}
+
+func verify(statuses []Status) error {
+  for _, s := range statuses {
+    if s.Modified() {
+      return fmt.Errorf("checksum mismatch for migration %d (%s)", s.Version, s.Name)
+    }
+  }
+
+  return nil
+}
+
+// Up applies every pending migration up to target, or all of them when
+// target is 0
+func (m *Migrator) Up(target int) error {
+  return m.locked(func(conn *sql.Conn) error {
+    return m.up(conn, target)
+  })
+}
+
+func (m *Migrator) up(conn *sql.Conn, target int) error {
+  statuses, err := m.status(conn)
+  if err != nil {
+    return err
+  }
+
+  if err = verify(statuses); err != nil {
+    return err
+  }
+
+  for _, s := range statuses {
+    if s.Applied || (target > 0 && s.Version > target) {
+      continue
+    }
+
+    migrationLog.WithFields(log.Fields{
+      "version": s.Version,
+      "name": s.Name,
+    }).Info("applying migration")
+
+    err := m.transaction(conn, s.Up, func(tx *sql.Tx) error {
+      _, err := tx.Exec(
+        "INSERT INTO schema_migrations(version, name, checksum) VALUES($1, $2, $3)",
+        s.Version, s.Name, s.Checksum())
+      return err
+    })
+
+    if err != nil {
+      return fmt.Errorf("migration %d (%s) failed: %s", s.Version, s.Name, err)
+    }
+  }
+
+  return nil
+}
+
+// Down reverts the last steps applied migrations
+func (m *Migrator) Down(steps int) error {
+  return m.locked(func(conn *sql.Conn) error {
+    return m.down(conn, steps)
+  })
+}
+
+func (m *Migrator) down(conn *sql.Conn, steps int) error {
+  statuses, err := m.status(conn)
+  if err != nil {
+    return err
+  }
+
+  if err = verify(statuses); err != nil {
+    return err
+  }
+
+  for i := len(statuses) - 1; i >= 0 && steps > 0; i-- {
+    s := statuses[i]
+
+    if !s.Applied {
+      continue
+    }
+
+    migrationLog.WithFields(log.Fields{
+      "version": s.Version,
+      "name": s.Name,
+    }).Info("reverting migration")
+
+    err := m.transaction(conn, s.Down, func(tx *sql.Tx) error {
+      _, err := tx.Exec("DELETE FROM schema_migrations WHERE version=$1", s.Version)
+      return err
+    })
+
+    if err != nil {
+      return fmt.Errorf("migration %d (%s) revert failed: %s", s.Version, s.Name, err)
+    }
+
+    steps--
+  }
+
+  return nil
+}
+
+// transaction runs a migration on the locked connection
+func (m *Migrator) transaction(conn *sql.Conn, query string, record func(*sql.Tx) error) error {
+  tx, err := conn.BeginTx(context.Background(), nil)
+  if err != nil {
+    return err
+  }
+
+  if _, err = tx.Exec(query); err == nil {
+    err = record(tx)
+  }
+
+  if err != nil {
+    tx.Rollback()
+    return err
+  }
+
+  return tx.Commit()
+}
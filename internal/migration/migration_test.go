@@ -0,0 +1,160 @@
+package migration
+
+import (
+	sql     "database/sql"
+	os      "os"
+	_       "github.com/lib/pq"
+	sync    "sync"
+	testing "testing"
+)
+
+// testDatabaseVariable names the URL of a PostgreSQL database the tests may
+// wipe; the tests needing one are skipped without it
+const testDatabaseVariable = "NEEDYS_API_RESOURCE_TEST_DATABASE_URL"
+
+func testDatabase(t *testing.T) *sql.DB {
+	url := os.Getenv(testDatabaseVariable)
+	if url == "" {
+		t.Skip(testDatabaseVariable + " is not set")
+	}
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("could not open the test database: %s", err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	// every test starts from an empty schema
+	if err = New(db).Down(len(Migrations)); err != nil {
+		t.Fatalf("could not revert the migrations of the test database: %s", err)
+	}
+
+	return db
+}
+
+func applied(t *testing.T, m *Migrator) []int {
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("could not read the status of the migrations: %s", err)
+	}
+
+	versions := []int{}
+
+	for _, s := range statuses {
+		if s.Applied {
+			versions = append(versions, s.Version)
+		}
+	}
+
+	return versions
+}
+
+func TestUpAndDown(t *testing.T) {
+	m := New(testDatabase(t))
+
+	if versions := applied(t, m); len(versions) != 0 {
+		t.Fatalf("expected no migration to be applied, but actual are: %v", versions)
+	}
+
+	if err := m.Up(2); err != nil {
+		t.Fatalf("could not apply the migrations up to 2: %s", err)
+	}
+
+	if versions := applied(t, m); len(versions) != 2 || versions[1] != 2 {
+		t.Fatalf("expected the migrations 1 and 2 to be applied, but actual are: %v", versions)
+	}
+
+	if err := m.Up(0); err != nil {
+		t.Fatalf("could not apply every migration: %s", err)
+	}
+
+	if versions := applied(t, m); len(versions) != len(Migrations) {
+		t.Fatalf("expected every migration to be applied, but actual are: %v", versions)
+	}
+
+	if err := m.Down(1); err != nil {
+		t.Fatalf("could not revert the last migration: %s", err)
+	}
+
+	if versions := applied(t, m); len(versions) != len(Migrations) - 1 {
+		t.Fatalf("expected the last migration to be reverted, but actual are: %v", versions)
+	}
+
+	if err := m.Down(len(Migrations)); err != nil {
+		t.Fatalf("could not revert every migration: %s", err)
+	}
+
+	if versions := applied(t, m); len(versions) != 0 {
+		t.Fatalf("expected every migration to be reverted, but actual are: %v", versions)
+	}
+}
+
+func TestConcurrentUpsApplyEveryMigrationOnce(t *testing.T) {
+	db := testDatabase(t)
+
+	var ups sync.WaitGroup
+	errs := make([]error, 4)
+
+	for i := range errs {
+		ups.Add(1)
+
+		go func(i int) {
+			defer ups.Done()
+			errs[i] = New(db).Up(0)
+		}(i)
+	}
+
+	ups.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("could not apply the migrations concurrently: %s", err)
+		}
+	}
+
+	if versions := applied(t, New(db)); len(versions) != len(Migrations) {
+		t.Fatalf("expected every migration to be applied, but actual are: %v", versions)
+	}
+}
+
+func TestVerifyDetectsAnEditedMigration(t *testing.T) {
+	migration := Migrations[0]
+	statuses := []Status{{Migration: migration, Applied: true, AppliedChecksum: migration.Checksum()}}
+
+	if err := verify(statuses); err != nil {
+		t.Fatalf("expected an unchanged migration to pass the verification: %s", err)
+	}
+
+	statuses[0].Up += "\n-- edited afterwards"
+
+	if err := verify(statuses); err == nil {
+		t.Fatal("expected an edited migration to fail the verification")
+	}
+}
+
+func TestChecksumMismatchIsDetected(t *testing.T) {
+	db := testDatabase(t)
+
+	if err := New(db).Up(0); err != nil {
+		t.Fatalf("could not apply every migration: %s", err)
+	}
+
+	edited := make([]Migration, len(Migrations))
+	copy(edited, Migrations)
+	edited[0].Up += "\n-- edited afterwards"
+
+	m := &Migrator{DB: db, Migrations: edited}
+
+	if err := m.Verify(); err == nil {
+		t.Fatal("expected an edited migration to fail the verification")
+	}
+
+	if err := m.Up(0); err == nil {
+		t.Fatal("expected an edited migration to prevent the migrations")
+	}
+
+	if err := New(db).Verify(); err != nil {
+		t.Fatalf("expected the embedded migrations to pass the verification: %s", err)
+	}
+}
@@ -0,0 +1,162 @@
+package migration
+
+// Migrations are applied in Version order; an applied migration must never be
+// edited, add a new one instead.
+var Migrations = []Migration{
+  {
+    Version: 1,
+    Name:    "create_resources",
+    Up: `
+      CREATE TABLE IF NOT EXISTS resources (
+        id SERIAL,
+        type TEXT NOT NULL,
+        description TEXT NOT NULL,
+        CONSTRAINT resources_pkey PRIMARY KEY (id)
+      );
+      `,
+    Down: `
+      DROP TABLE IF EXISTS resources;
+      `,
+  },
+  {
+    Version: 2,
+    Name:    "add_resources_french_search",
+    Up: `
+      CREATE EXTENSION IF NOT EXISTS unaccent;
+
+      CREATE TEXT SEARCH CONFIGURATION french_unaccent (COPY = french);
+      ALTER TEXT SEARCH CONFIGURATION french_unaccent
+        ALTER MAPPING FOR hword, hword_part, word WITH unaccent, french_stem;
+
+      ALTER TABLE resources ADD COLUMN search_vector tsvector;
+
+      CREATE FUNCTION resources_search_vector_update() RETURNS trigger AS $$
+      BEGIN
+        NEW.search_vector := to_tsvector('french_unaccent', coalesce(NEW.description, ''));
+        RETURN NEW;
+      END
+      $$ LANGUAGE plpgsql;
+
+      CREATE TRIGGER resources_search_vector_trigger
+        BEFORE INSERT OR UPDATE OF description ON resources
+        FOR EACH ROW EXECUTE PROCEDURE resources_search_vector_update();
+
+      UPDATE resources SET search_vector = to_tsvector('french_unaccent', description);
+
+      CREATE INDEX resources_search_vector_idx ON resources USING GIN (search_vector);
+      `,
+    Down: `
+      DROP TRIGGER IF EXISTS resources_search_vector_trigger ON resources;
+      DROP FUNCTION IF EXISTS resources_search_vector_update();
+      DROP INDEX IF EXISTS resources_search_vector_idx;
+      ALTER TABLE resources DROP COLUMN IF EXISTS search_vector;
+      DROP TEXT SEARCH CONFIGURATION IF EXISTS french_unaccent;
+      `,
+  },
+  {
+    Version: 3,
+    Name:    "add_resources_version",
+    Up: `
+      ALTER TABLE resources ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+      `,
+    Down: `
+      ALTER TABLE resources DROP COLUMN IF EXISTS version;
+      `,
+  },
+  {
+    Version: 4,
+    Name:    "add_resources_audit_columns",
+    Up: `
+      ALTER TABLE resources
+        ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        ADD COLUMN created_by TEXT NOT NULL DEFAULT '',
+        ADD COLUMN updated_by TEXT NOT NULL DEFAULT '';
+
+      CREATE INDEX resources_created_at_idx ON resources (created_at);
+      CREATE INDEX resources_updated_at_idx ON resources (updated_at);
+      `,
+    Down: `
+      DROP INDEX IF EXISTS resources_updated_at_idx;
+      DROP INDEX IF EXISTS resources_created_at_idx;
+      ALTER TABLE resources
+        DROP COLUMN IF EXISTS created_at,
+        DROP COLUMN IF EXISTS updated_at,
+        DROP COLUMN IF EXISTS created_by,
+        DROP COLUMN IF EXISTS updated_by;
+      `,
+  },
+  {
+    Version: 5,
+    Name:    "add_resources_deleted_at",
+    Up: `
+      ALTER TABLE resources ADD COLUMN deleted_at TIMESTAMPTZ;
+
+      CREATE INDEX resources_deleted_at_idx ON resources (deleted_at) WHERE deleted_at IS NOT NULL;
+      `,
+    Down: `
+      DROP INDEX IF EXISTS resources_deleted_at_idx;
+      ALTER TABLE resources DROP COLUMN IF EXISTS deleted_at;
+      `,
+  },
+  {
+    Version: 6,
+    Name:    "create_resource_revisions",
+    Up: `
+      CREATE TABLE resource_revisions (
+        resource_id INTEGER NOT NULL REFERENCES resources (id) ON DELETE CASCADE,
+        revision INTEGER NOT NULL,
+        operation TEXT NOT NULL,
+        actor TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL,
+        data JSONB NOT NULL,
+        CONSTRAINT resource_revisions_pkey PRIMARY KEY (resource_id, revision)
+      );
+
+      INSERT INTO resource_revisions (resource_id, revision, operation, actor, created_at, data)
+        SELECT id, version, 'imported', updated_by, updated_at, jsonb_build_object(
+          'id', id, 'type', type, 'description', description, 'version', version,
+          'created_at', created_at, 'updated_at', updated_at,
+          'created_by', created_by, 'updated_by', updated_by, 'deleted_at', deleted_at)
+        FROM resources;
+      `,
+    Down: `
+      DROP TABLE IF EXISTS resource_revisions;
+      `,
+  },
+  {
+    Version: 7,
+    Name:    "create_resource_needs",
+    Up: `
+      CREATE TABLE resource_needs (
+        resource_id INTEGER NOT NULL REFERENCES resources (id) ON DELETE CASCADE,
+        need_id INTEGER NOT NULL,
+        CONSTRAINT resource_needs_pkey PRIMARY KEY (resource_id, need_id)
+      );
+
+      CREATE INDEX resource_needs_need_id_idx ON resource_needs (need_id);
+      `,
+    Down: `
+      DROP TABLE IF EXISTS resource_needs;
+      `,
+  },
+  {
+    Version: 8,
+    Name:    "create_outbox",
+    Up: `
+      CREATE TABLE outbox (
+        id BIGSERIAL PRIMARY KEY,
+        event JSONB NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+        published_at TIMESTAMPTZ,
+        attempts INTEGER NOT NULL DEFAULT 0,
+        last_error TEXT NOT NULL DEFAULT ''
+      );
+
+      CREATE INDEX outbox_pending_idx ON outbox (id) WHERE published_at IS NULL;
+      `,
+    Down: `
+      DROP TABLE IF EXISTS outbox;
+      `,
+  },
+}
@@ -0,0 +1,100 @@
+package need
+
+import (
+  context "context"
+  fmt     "fmt"
+  http    "net/http"
+  log     "github.com/sirupsen/logrus"
+  strings "strings"
+  sync    "sync"
+  time    "time"
+)
+
+var clientLog *log.Entry
+
+func init() {
+  clientLog = log.WithFields(log.Fields{
+    "_file": "internal/need/client.go",
+    "_type": "system",
+  })
+}
+
+// Client checks needs against the needys-api-need service
+type Client interface {
+  // Exists tells whether the need with an ID exists
+  Exists(ctx context.Context, id int) (bool, error)
+}
+
+// HTTPClient queries GET /need/{id} on the needys-api-need service
+type HTTPClient struct {
+  BaseURL string
+  HTTP    *http.Client
+}
+
+func NewHTTPClient(baseURL string, timeout time.Duration) *HTTPClient {
+  return &HTTPClient{
+    BaseURL: strings.TrimSuffix(baseURL, "/"),
+    HTTP: &http.Client{Timeout: timeout},
+  }
+}
+
+func (c *HTTPClient) Exists(ctx context.Context, id int) (bool, error) {
+  url := fmt.Sprintf("%s/need/%d", c.BaseURL, id)
+
+  clientLog.WithFields(log.Fields{
+    "type": "need service query",
+    "parameter_id": id,
+  }).Debug("GET " + url)
+
+  request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+  if err != nil {
+    return false, err
+  }
+
+  response, err := c.HTTP.Do(request)
+  if err != nil {
+    return false, err
+  }
+
+  defer response.Body.Close()
+
+  switch response.StatusCode {
+  case http.StatusOK:
+    return true, nil
+  case http.StatusNotFound:
+    return false, nil
+  default:
+    return false, fmt.Errorf("the need service answered %s", response.Status)
+  }
+}
+
+// FakeClient knows a fixed set of needs; it stands for the need service in
+// tests and when running without it
+type FakeClient struct {
+  mutex sync.RWMutex
+  needs map[int]bool
+}
+
+func NewFakeClient(ids ...int) *FakeClient {
+  c := &FakeClient{needs: make(map[int]bool)}
+  c.Add(ids...)
+
+  return c
+}
+
+// Add makes needs exist
+func (c *FakeClient) Add(ids ...int) {
+  c.mutex.Lock()
+  defer c.mutex.Unlock()
+
+  for _, id := range ids {
+    c.needs[id] = true
+  }
+}
+
+func (c *FakeClient) Exists(_ context.Context, id int) (bool, error) {
+  c.mutex.RLock()
+  defer c.mutex.RUnlock()
+
+  return c.needs[id], nil
+}
@@ -0,0 +1,136 @@
+package internal
+
+import (
+  context  "context"
+  fmt      "fmt"
+  log      "github.com/sirupsen/logrus"
+  need     "github.com/gpenaud/needys-api-resource/internal/need"
+  resource "github.com/gpenaud/needys-api-resource/internal/resource"
+  sync     "sync"
+  time     "time"
+)
+
+var needsLog *log.Entry
+
+func init() {
+  needsLog = log.WithFields(log.Fields{
+    "_file": "internal/needs.go",
+    "_type": "system",
+  })
+}
+
+// initializeNeeds connects to the need service, unless a client was injected
+// beforehand, e.g. a fake one
+func (a *Application) initializeNeeds() {
+  if a.Needs != nil {
+    return
+  }
+
+  if a.Config.Need.URL == "" {
+    needsLog.Warn("no need service is configured, the needs of resources are not checked")
+    return
+  }
+
+  a.Needs = need.NewHTTPClient(a.Config.Need.URL, time.Duration(a.Config.Need.Timeout) * time.Second)
+
+  needsLog.WithFields(log.Fields{
+    "url": a.Config.Need.URL,
+  }).Info("needs of resources are checked against the need service")
+}
+
+// checkNeeds fails with a validation error when one of the needs does not
+// exist in the need service; the needs are checked at once, all within the
+// timeout of the need service
+func (a *Application) checkNeeds(ctx context.Context, ids []int) error {
+  if a.Needs == nil || len(ids) == 0 {
+    return nil
+  }
+
+  if timeout := time.Duration(a.Config.Need.Timeout) * time.Second; timeout > 0 {
+    var cancel context.CancelFunc
+
+    ctx, cancel = context.WithTimeout(ctx, timeout)
+    defer cancel()
+  }
+
+  exists := make([]bool, len(ids))
+  errs := make([]error, len(ids))
+
+  var checks sync.WaitGroup
+
+  for i, id := range ids {
+    checks.Add(1)
+
+    go func(i, id int) {
+      defer checks.Done()
+      exists[i], errs[i] = a.Needs.Exists(ctx, id)
+    }(i, id)
+  }
+
+  checks.Wait()
+
+  var problems []resource.FieldError
+
+  for i, id := range ids {
+    if errs[i] != nil {
+      return unavailable("The need service is not available", errs[i])
+    }
+
+    if !exists[i] {
+      problems = append(problems, resource.FieldError{
+        Field: "needs",
+        Message: fmt.Sprintf("need %d does not exist", id),
+      })
+    }
+  }
+
+  if len(problems) > 0 {
+    return &resource.ValidationError{Errors: problems}
+  }
+
+  return nil
+}
+
+// patchAttempts bounds how many times a patch sent without If-Match is
+// applied again after the resource changed while its needs were checked
+const patchAttempts = 3
+
+// patchCheckingNeeds applies a patch once the needs it adds are checked in the
+// need service, outside of the store: the patch is tried on the resource read
+// beforehand, then only applied to this version of it, so a concurrent change
+// cannot add needs which were not checked
+func (a *Application) patchCheckingNeeds(ctx context.Context, res *resource.Resource, patch resource.Patch) error {
+  expected := res.Version
+
+  for attempt := 1; ; attempt++ {
+    current := resource.Resource{ID: res.ID}
+
+    if err := a.Store.GetResource(&current); err != nil {
+      return err
+    }
+
+    if expected != 0 && expected != current.Version {
+      return resource.ErrVersionMismatch
+    }
+
+    patched := current
+
+    if err := patched.Apply(patch); err != nil {
+      return err
+    }
+
+    if err := a.checkNeeds(ctx, resource.AddedNeeds(current, patched)); err != nil {
+      return err
+    }
+
+    res.Version = current.Version
+
+    err := a.Store.PatchResource(ctx, res, func(stored *resource.Resource) error {
+      return stored.Apply(patch)
+    })
+
+    if err != resource.ErrVersionMismatch || expected != 0 || attempt == patchAttempts {
+      return err
+    }
+  }
+}
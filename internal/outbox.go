@@ -0,0 +1,82 @@
+package internal
+
+import (
+  context "context"
+  event   "github.com/gpenaud/needys-api-resource/internal/event"
+  log     "github.com/sirupsen/logrus"
+  time    "time"
+)
+
+var outboxLog *log.Entry
+
+func init() {
+  outboxLog = log.WithFields(log.Fields{
+    "_file": "internal/outbox.go",
+    "_type": "system",
+  })
+}
+
+// outboxBatchSize is the number of events relayed at once
+const outboxBatchSize = 100
+
+// relayEvents delivers the events of the outbox to the publisher, every poll
+// interval, until the context is done; after a failure, the same event is
+// tried again later, with a growing delay, so none is lost nor reordered
+func (a *Application) relayEvents(ctx context.Context) {
+  // without a publisher, the store does not announce changes in the outbox
+  if a.Events == nil {
+    return
+  }
+
+  interval := time.Duration(a.Config.Outbox.PollInterval) * time.Second
+  retention := time.Duration(a.Config.Outbox.RetentionHours) * time.Hour
+
+  delay := interval
+  var purged time.Time
+
+  for {
+    relayed, err := a.Store.RelayEvents(outboxBatchSize, func(e event.Event) error {
+      return a.Events.Publish(ctx, e)
+    })
+
+    switch {
+    case err != nil && ctx.Err() == nil:
+      if delay < initialRetryDelay {
+        delay = initialRetryDelay
+      } else if delay *= 2; delay > maximumRetryDelay {
+        delay = maximumRetryDelay
+      }
+
+      outboxLog.WithFields(log.Fields{
+        "relayed": relayed,
+        "retry_in": delay.String(),
+        "error": err,
+      }).Error("could not relay the events of the outbox")
+    case relayed == outboxBatchSize:
+      // more events are waiting
+      delay = 0
+    default:
+      delay = interval
+    }
+
+    if retention > 0 && time.Since(purged) > time.Hour {
+      purged = time.Now()
+
+      if n, err := a.Store.PurgeEvents(purged.Add(-retention)); err != nil {
+        outboxLog.WithFields(log.Fields{
+          "error": err,
+        }).Error("could not purge the outbox")
+      } else if n > 0 {
+        outboxLog.WithFields(log.Fields{
+          "purged": n,
+        }).Info("purged the delivered events of the outbox")
+      }
+    }
+
+    select {
+    case <-ctx.Done():
+      return
+    case <-time.After(delay):
+    }
+  }
+}
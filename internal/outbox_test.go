@@ -0,0 +1,153 @@
+package internal
+
+import (
+	context  "context"
+	errors   "errors"
+	event    "github.com/gpenaud/needys-api-resource/internal/event"
+	resource "github.com/gpenaud/needys-api-resource/internal/resource"
+	testing  "testing"
+	time     "time"
+)
+
+// newRelayingApplication runs against an in-memory store announcing its
+// changes, and a recorder for the message broker
+func newRelayingApplication() (*Application, *event.Recorder) {
+	recorder := event.NewRecorder()
+
+	a := &Application{
+		Config: &Configuration{},
+		Store:  resource.NewMemoryStore(),
+		Events: recorder,
+	}
+
+	a.Config.Outbox.PollInterval = 1
+	a.Store.EnableOutbox()
+
+	return a, recorder
+}
+
+// startRelay runs the relay until the returned function stops it, which
+// fails the test unless the relay returns shortly after
+func startRelay(t *testing.T, a *Application) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		a.relayEvents(ctx)
+		close(done)
+	}()
+
+	return func() {
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("the relay did not stop once cancelled")
+		}
+	}
+}
+
+// waitForEvents returns the events recorded once there are count of them
+func waitForEvents(t *testing.T, recorder *event.Recorder, count int) []event.Event {
+	deadline := time.Now().Add(3 * time.Second)
+
+	for time.Now().Before(deadline) {
+		if events := recorder.Events(); len(events) >= count {
+			return events
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("expected %d events to be published, but actual are: %d", count, len(recorder.Events()))
+	return nil
+}
+
+func TestChangesAreOnlyAnnouncedOnceTheOutboxIsEnabled(t *testing.T) {
+	store := resource.NewMemoryStore()
+	deliver := func(event.Event) error { return nil }
+
+	store.CreateResource(context.Background(), &resource.Resource{Type: "individual", Description: "faire une sieste"})
+
+	if relayed, _ := store.RelayEvents(10, deliver); relayed != 0 {
+		t.Fatalf("expected no event in a disabled outbox, but actual are: %d", relayed)
+	}
+
+	store.EnableOutbox()
+
+	ctx := resource.WithChange(context.Background(), "someone", "a-correlation-id")
+	store.CreateResource(ctx, &resource.Resource{Type: "individual", Description: "faire une sieste"})
+
+	var events []event.Event
+
+	store.RelayEvents(10, func(e event.Event) error {
+		events = append(events, e)
+		return nil
+	})
+
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event in the outbox, but actual are: %d", len(events))
+	}
+
+	e := events[0]
+
+	if e.Type != event.ResourceCreated || e.Actor != "someone" || e.CorrelationID != "a-correlation-id" {
+		t.Fatalf("expected a creation by someone for a-correlation-id, but actual is: %s by %q for %q",
+			e.Type, e.Actor, e.CorrelationID)
+	}
+}
+
+func TestRelayEventsDeliversTheEventsInOrder(t *testing.T) {
+	a, recorder := newRelayingApplication()
+
+	r := resource.Resource{Type: "individual", Description: "faire une sieste"}
+	ctx := context.Background()
+	a.Store.CreateResource(ctx, &r)
+
+	r.Description = "faire une longue sieste"
+	a.Store.UpdateResource(ctx, &r)
+	a.Store.DeleteResource(ctx, &resource.Resource{ID: r.ID})
+
+	stop := startRelay(t, a)
+	events := waitForEvents(t, recorder, 3)
+	stop()
+
+	expected := []string{event.ResourceCreated, event.ResourceUpdated, event.ResourceDeleted}
+
+	for i, e := range events {
+		if e.Type != expected[i] {
+			t.Fatalf("expected the event %d to be %s, but actual is: %s", i, expected[i], e.Type)
+		}
+	}
+}
+
+func TestRelayEventsRetriesAFailedDelivery(t *testing.T) {
+	a, recorder := newRelayingApplication()
+	recorder.Fail(errors.New("the broker is down"))
+
+	a.Store.CreateResource(context.Background(), &resource.Resource{Type: "individual", Description: "faire une sieste"})
+
+	stop := startRelay(t, a)
+	defer stop()
+
+	time.Sleep(100 * time.Millisecond)
+
+	if events := recorder.Events(); len(events) != 0 {
+		t.Fatalf("expected no event to be published while the broker is down, but actual are: %d", len(events))
+	}
+
+	recorder.Fail(nil)
+
+	if events := waitForEvents(t, recorder, 1); len(events) != 1 {
+		t.Fatalf("expected the event to be published once, but actual are: %d", len(events))
+	}
+}
+
+func TestRelayEventsStopsOnCancel(t *testing.T) {
+	a, _ := newRelayingApplication()
+
+	stop := startRelay(t, a)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+}
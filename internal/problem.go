@@ -0,0 +1,224 @@
+package internal
+
+import (
+  context  "context"
+  driver   "database/sql/driver"
+  errors   "errors"
+  hex      "encoding/hex"
+  http     "net/http"
+  net      "net"
+  log      "github.com/sirupsen/logrus"
+  rand     "crypto/rand"
+  resource "github.com/gpenaud/needys-api-resource/internal/resource"
+)
+
+var problemLog *log.Entry
+
+func init() {
+  problemLog = log.WithFields(log.Fields{
+    "_file": "internal/problem.go",
+    "_type": "user",
+  })
+}
+
+type errorKind int
+
+const (
+  badRequestError errorKind = iota
+  unauthorizedError
+  forbiddenError
+  notFoundError
+  methodNotAllowedError
+  conflictError
+  preconditionFailedError
+  preconditionRequiredError
+  payloadTooLargeError
+  unsupportedMediaTypeError
+  validationError
+  unavailableError
+  internalError
+)
+
+var errorKinds = map[errorKind]struct {
+  status int
+  slug   string
+  title  string
+}{
+  badRequestError:   {http.StatusBadRequest, "bad-request", "Bad request"},
+  unauthorizedError: {http.StatusUnauthorized, "unauthorized", "Unauthorized"},
+  forbiddenError:    {http.StatusForbidden, "forbidden", "Forbidden"},
+  notFoundError:     {http.StatusNotFound, "not-found", "Resource not found"},
+  methodNotAllowedError: {
+    http.StatusMethodNotAllowed, "method-not-allowed", "Method not allowed"},
+  conflictError:     {http.StatusConflict, "conflict", "Conflict"},
+  preconditionFailedError: {
+    http.StatusPreconditionFailed, "precondition-failed", "Precondition failed"},
+  preconditionRequiredError: {
+    http.StatusPreconditionRequired, "precondition-required", "Precondition required"},
+  payloadTooLargeError: {
+    http.StatusRequestEntityTooLarge, "payload-too-large", "Payload too large"},
+  unsupportedMediaTypeError: {
+    http.StatusUnsupportedMediaType, "unsupported-media-type", "Unsupported media type"},
+  validationError:   {http.StatusUnprocessableEntity, "validation", "Invalid payload"},
+  unavailableError:  {http.StatusServiceUnavailable, "unavailable", "Service unavailable"},
+  internalError:     {http.StatusInternalServerError, "internal", "Internal error"},
+}
+
+// Error is an error answered to clients as a problem; its Cause is logged but
+// never returned
+type Error struct {
+  Kind   errorKind
+  Detail string
+  Cause  error
+  Fields []resource.FieldError
+}
+
+func (e *Error) Error() string {
+  if e.Cause != nil {
+    return e.Detail + ": " + e.Cause.Error()
+  }
+
+  return e.Detail
+}
+
+func badRequest(detail string) *Error {
+  return &Error{Kind: badRequestError, Detail: detail}
+}
+
+func unauthorized(detail string) *Error {
+  return &Error{Kind: unauthorizedError, Detail: detail}
+}
+
+func forbidden(detail string) *Error {
+  return &Error{Kind: forbiddenError, Detail: detail}
+}
+
+func notFound(detail string) *Error {
+  return &Error{Kind: notFoundError, Detail: detail}
+}
+
+func methodNotAllowed(detail string) *Error {
+  return &Error{Kind: methodNotAllowedError, Detail: detail}
+}
+
+func conflict(detail string) *Error {
+  return &Error{Kind: conflictError, Detail: detail}
+}
+
+func preconditionFailed(detail string) *Error {
+  return &Error{Kind: preconditionFailedError, Detail: detail}
+}
+
+func preconditionRequired(detail string) *Error {
+  return &Error{Kind: preconditionRequiredError, Detail: detail}
+}
+
+func payloadTooLarge(detail string) *Error {
+  return &Error{Kind: payloadTooLargeError, Detail: detail}
+}
+
+func unsupportedMediaType(detail string) *Error {
+  return &Error{Kind: unsupportedMediaTypeError, Detail: detail}
+}
+
+func unprocessable(detail string) *Error {
+  return &Error{Kind: validationError, Detail: detail}
+}
+
+func invalid(fields []resource.FieldError) *Error {
+  return &Error{Kind: validationError, Detail: "The payload is invalid", Fields: fields}
+}
+
+func unavailable(detail string, cause error) *Error {
+  return &Error{Kind: unavailableError, Detail: detail, Cause: cause}
+}
+
+func internal(cause error) *Error {
+  return &Error{Kind: internalError, Detail: "An internal error occurred", Cause: cause}
+}
+
+// asError maps the errors of the lower layers to the errors answered
+func asError(err error) *Error {
+  switch e := err.(type) {
+  case *Error:
+    return e
+  case *resource.ValidationError:
+    return invalid(e.Errors)
+  case *resource.PatchError:
+    return unprocessable("The patch cannot be applied: " + e.Message)
+  }
+
+  switch err {
+  case resource.ErrNotFound:
+    return notFound("The resource is not found")
+  case resource.ErrVersionMismatch:
+    return preconditionFailed("The resource has been changed since the version given by If-Match")
+  }
+
+  if isUnreachable(err) {
+    return unavailable("The database is not available", err)
+  }
+
+  return internal(err)
+}
+
+// isUnreachable tells whether an error comes from a database which cannot be
+// reached or answers too slowly, rather than from a failing query
+func isUnreachable(err error) bool {
+  var netError net.Error
+
+  return errors.Is(err, driver.ErrBadConn) ||
+    errors.Is(err, context.DeadlineExceeded) ||
+    errors.As(err, &netError)
+}
+
+// Problem is an RFC 7807 problem details object
+type Problem struct {
+  Type          string                `json:"type"`
+  Title         string                `json:"title"`
+  Status        int                   `json:"status"`
+  Detail        string                `json:"detail,omitempty"`
+  Instance      string                `json:"instance,omitempty"`
+  CorrelationID string                `json:"correlation_id,omitempty"`
+  Errors        []resource.FieldError `json:"errors,omitempty"`
+}
+
+// -------------------------------------------------------------------------- //
+// Correlation identifiers
+
+type contextKey string
+
+const correlationIDKey contextKey = "correlation_id"
+
+const CorrelationIDHeader = "X-Correlation-ID"
+
+// correlate gives every request a correlation identifier, the one sent by the
+// client if any, echoed in the response headers and in problems
+func correlate(next http.Handler) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    id := r.Header.Get(CorrelationIDHeader)
+
+    if id == "" || len(id) > 128 {
+      id = newCorrelationID()
+    }
+
+    w.Header().Set(CorrelationIDHeader, id)
+
+    next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), correlationIDKey, id)))
+  })
+}
+
+func newCorrelationID() string {
+  bytes := make([]byte, 16)
+
+  if _, err := rand.Read(bytes); err != nil {
+    problemLog.Warn("could not generate a correlation id: ", err)
+  }
+
+  return hex.EncodeToString(bytes)
+}
+
+func correlationID(r *http.Request) string {
+  id, _ := r.Context().Value(correlationIDKey).(string)
+  return id
+}
@@ -0,0 +1,40 @@
+package internal
+
+import (
+	context  "context"
+	driver   "database/sql/driver"
+	errors   "errors"
+	fmt      "fmt"
+	http     "net/http"
+	net      "net"
+	resource "github.com/gpenaud/needys-api-resource/internal/resource"
+	testing  "testing"
+)
+
+func TestAsError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"not found", resource.ErrNotFound, http.StatusNotFound},
+		{"version mismatch", resource.ErrVersionMismatch, http.StatusPreconditionFailed},
+		{"validation", &resource.ValidationError{}, http.StatusUnprocessableEntity},
+		{"bad connection", driver.ErrBadConn, http.StatusServiceUnavailable},
+		{"wrapped bad connection", fmt.Errorf("query failed: %w", driver.ErrBadConn), http.StatusServiceUnavailable},
+		{"deadline", context.DeadlineExceeded, http.StatusServiceUnavailable},
+		{"network", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, http.StatusServiceUnavailable},
+		{"canceled", context.Canceled, http.StatusInternalServerError},
+		{"other", errors.New("syntax error at or near"), http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := asError(test.err)
+
+			if status := errorKinds[e.Kind].status; status != test.status {
+				t.Errorf("expected the status to be: %d, but actual is: %d", test.status, status)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package resource
+
+import (
+  context "context"
+)
+
+// change tells who makes the changes of resources, and in which request;
+// it travels with the context given to the store, not with the resources
+type change struct {
+  actor         string
+  correlationID string
+}
+
+type changeKey struct{}
+
+// WithChange returns a context in which the store records actor as the author
+// of the changes, and announces them with the correlation identifier of the
+// request making them
+func WithChange(ctx context.Context, actor, correlationID string) context.Context {
+  return context.WithValue(ctx, changeKey{}, change{actor: actor, correlationID: correlationID})
+}
+
+// changeOf returns the change of a context; changes made outside of a request
+// are made by the system
+func changeOf(ctx context.Context) change {
+  if c, found := ctx.Value(changeKey{}).(change); found {
+    return c
+  }
+
+  return change{actor: SystemActor}
+}
@@ -1,105 +1,115 @@
 package resource
 
 import (
-  log "github.com/sirupsen/logrus"
-  sql "database/sql"
+  context "context"
+  errors  "errors"
+  event   "github.com/gpenaud/needys-api-resource/internal/event"
+  log     "github.com/sirupsen/logrus"
+  time    "time"
 )
 
 type Resource struct {
-  ID          int    `json:"id"`
-  Type        string `json:"type"`
-  Description string `json:"description"`
+  ID          int        `json:"id"`
+  Type        string     `json:"type"`
+  Description string     `json:"description"`
+  // Needs are the IDs of the needs of needys-api-need the resource answers,
+  // in increasing order
+  Needs       []int      `json:"needs"`
+  // Version is incremented by the store on every change of the resource
+  Version     int        `json:"version"`
+  // the store sets the timestamps and the actors, UpdatedBy the one of the
+  // last change and CreatedBy the one of the creation, from the context of
+  // the change (see WithChange)
+  CreatedAt   time.Time  `json:"created_at"`
+  UpdatedAt   time.Time  `json:"updated_at"`
+  CreatedBy   string     `json:"created_by"`
+  UpdatedBy   string     `json:"updated_by"`
+  // DeletedAt is set while the resource is in the trash
+  DeletedAt   *time.Time `json:"deleted_at,omitempty"`
 }
 
-var resourceLog *log.Entry
-
-func init() {
-  resourceLog = log.WithFields(log.Fields{
-    "_file": "internal/resource/crud.go",
-    "_type": "user",
-  })
+// ResourceStore abstracts the persistence of resources, so the HTTP layer
+// does not depend on a particular database.
+type ResourceStore interface {
+  GetResource(r *Resource) error
+  // GetTrashedResource reads a resource from the trash, and returns
+  // ErrNotFound for a live one
+  GetTrashedResource(r *Resource) error
+  // the changes are made by the actor of the context, see WithChange.
+  // UpdateResource, PatchResource, DeleteResource and RestoreResource only
+  // change a resource whose version is r.Version, unless it is 0, and return
+  // ErrVersionMismatch otherwise
+  UpdateResource(ctx context.Context, r *Resource) error
+  // PatchResource loads the resource with the ID of r, changes it with apply
+  // and stores it, so no other change on it can interleave; r then holds the
+  // stored resource. The resource is left as is when apply returns
+  // ErrNoChange.
+  PatchResource(ctx context.Context, r *Resource, apply func(*Resource) error) error
+  // DeleteResource moves a resource to the trash, where the other methods
+  // do not see it, unless a Query lists the trash
+  DeleteResource(ctx context.Context, r *Resource) error
+  // RestoreResource brings a resource back from the trash
+  RestoreResource(ctx context.Context, r *Resource) error
+  // RevertResource changes a live resource back to the type, description and
+  // needs it had at one of its revisions
+  RevertResource(ctx context.Context, r *Resource, revision int) error
+  // ListRevisions returns the history of a resource, newest first
+  ListRevisions(id int) ([]Revision, error)
+  // GetRevision returns one revision of a resource, with its changes from
+  // the previous one
+  GetRevision(id, revision int) (Revision, error)
+  // PurgeResources removes for good the resources in the trash since before
+  // a time, and returns how many were removed
+  PurgeResources(before time.Time) (int, error)
+  // RelayEvents hands to deliver, oldest first, up to limit events of the
+  // outbox, where every change of a resource stores the event announcing it,
+  // and marks them delivered. It stops at the first failure, which it
+  // returns with how many were delivered, so the events of a resource are
+  // delivered in order, at least once.
+  RelayEvents(limit int, deliver func(event.Event) error) (int, error)
+  // PurgeEvents removes the events delivered before a time, and returns how
+  // many were removed
+  PurgeEvents(before time.Time) (int, error)
+  // EnableOutbox makes every change store the event announcing it in the
+  // outbox; until then, none is stored, as no publisher would relay it
+  EnableOutbox()
+  CreateResource(ctx context.Context, r *Resource) error
+  // GetResources returns count resources from start, ordered by id
+  GetResources(start, count int) ([]Resource, error)
+  ListResources(q Query) (Page, error)
+  // SearchResources returns up to limit resources whose description matches
+  // the French full-text query, the most relevant first
+  SearchResources(query string, limit int) ([]SearchResult, error)
+  CountResources() (int, error)
+  // Initialize brings the storage up to date, wipes it and seeds it with
+  // default resources
+  Initialize() error
+  Ping(ctx context.Context) error
 }
 
-func (r *Resource) GetResource(db *sql.DB) error {
-  resourceLog.WithFields(log.Fields{
-    "type": "database query",
-    "parameter_id": r.ID,
-  }).Debug("SELECT type, description FROM resources WHERE id={id}")
+var ErrNotFound = errors.New("resource not found")
 
-  return db.QueryRow("SELECT type, description FROM resources WHERE id=$1",
-    r.ID).Scan(&r.Type, &r.Description)
-}
-
-func (r *Resource) UpdateResource(db *sql.DB) error {
-  resourceLog.WithFields(log.Fields{
-    "type": "database query",
-    "parameter_type": r.Type,
-    "parameter_description": r.Description,
-    "parameter_id": r.ID,
-  }).Debug("UPDATE resources SET type={type}, description={description}s WHERE id={id}")
+var ErrVersionMismatch = errors.New("resource version mismatch")
 
-  _, err :=
-    db.Exec("UPDATE resources SET type=$1, description=$2 WHERE id=$3",
-      r.Type, r.Description, r.ID)
-
-  return err
-}
+var ErrRevisionNotFound = errors.New("resource revision not found")
 
-func (r *Resource) DeleteResource(db *sql.DB) error {
-  resourceLog.WithFields(log.Fields{
-    "type": "database query",
-    "parameter_id": r.ID,
-  }).Debug("DELETE FROM resources WHERE id={id}")
-
-  _, err := db.Exec("DELETE FROM resources WHERE id=$1", r.ID)
-
-  return err
-}
+// ErrNoChange is returned by a patch which leaves a resource as it is
+var ErrNoChange = errors.New("no change")
 
-func (r *Resource) CreateResource(db *sql.DB) error {
-  resourceLog.WithFields(log.Fields{
-    "type": "database query",
-    "parameter_type": r.Type,
-    "parameter_description": r.Description,
-  }).Debug("INSERT INTO resources(type, description) VALUES({type}, {description}) RETURNING id")
-
-  err := db.QueryRow(
-    "INSERT INTO resources(type, description) VALUES($1, $2) RETURNING id",
-    r.Type, r.Description).Scan(&r.ID)
-
-  if err != nil {
-    return err
-  }
+var resourceLog *log.Entry
 
-  return nil
+func init() {
+  resourceLog = log.WithFields(log.Fields{
+    "_file": "internal/resource/crud.go",
+    "_type": "user",
+  })
 }
 
-func GetResources(db *sql.DB, start, count int) ([]Resource, error) {
-  resourceLog.WithFields(log.Fields{
-    "type": "database query",
-    "parameter_count": count,
-    "parameter_start": start,
-  }).Debug("SELECT id, type, description FROM resources LIMIT {count} OFFSET {start}")
-
-  rows, err := db.Query(
-    "SELECT id, type, description FROM resources LIMIT $1 OFFSET $2",
-    count, start)
-
-  if err != nil {
-    return nil, err
-  }
-
-  defer rows.Close()
-
-  resources := []Resource{}
-
-  for rows.Next() {
-    var r Resource
-    if err := rows.Scan(&r.ID, &r.Type, &r.Description); err != nil {
-      return nil, err
-    }
-    resources = append(resources, r)
-  }
+// SystemActor is the actor of the changes made by the service itself
+const SystemActor = "system"
 
-  return resources, nil
+// Seeds are the default resources inserted by Initialize
+var Seeds = []Resource{
+  {Type: "individual", Description: "faire une sieste"},
+  {Type: "collective", Description: "faire une séance de biodanza"},
 }
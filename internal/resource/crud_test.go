@@ -3,17 +3,29 @@ package resource_test
 import(
 	bytes    "bytes"
 	colors   "github.com/cucumber/godog/colors"
+	context  "context"
+	event    "github.com/gpenaud/needys-api-resource/internal/event"
 	flag     "github.com/spf13/pflag"
 	fmt 		 "fmt"
 	godog    "github.com/cucumber/godog"
+	goflag   "flag"
 	http 		 "net/http"
+	httptest "net/http/httptest"
 	internal "github.com/gpenaud/needys-api-resource/internal"
+	ioutil   "io/ioutil"
 	json 		 "encoding/json"
+	need     "github.com/gpenaud/needys-api-resource/internal/need"
 	os 			 "os"
+	strings  "strings"
+	regexp   "regexp"
+	resource "github.com/gpenaud/needys-api-resource/internal/resource"
+	strconv  "strconv"
 	testing  "testing"
 )
 
 var application internal.Application
+var server      *httptest.Server
+var recorder    *event.Recorder
 
 func init() {
 	godog.BindCommandLineFlags("godog.", &opts)
@@ -26,6 +38,17 @@ func init() {
 	application.Config.LogFormat 	 = "text"
 	application.Config.Server.Host = "0.0.0.0"
 	application.Config.Server.Port = "8012"
+	application.Config.Maintenance.Token = "test"
+	application.Config.Pagination.DefaultPageSize = 10
+	application.Config.Pagination.MaxPageSize = 100
+
+	// the whole HTTP API runs against an in-memory store, no database needed
+	application.Store = resource.NewMemoryStore()
+	// and against a need service knowing the needs 1, 2 and 3
+	application.Needs = need.NewFakeClient(1, 2, 3)
+	// and the events of the outbox are relayed to a recorder, not a broker
+	recorder = event.NewRecorder()
+	application.Events = recorder
 }
 
 var opts = godog.Options{
@@ -34,14 +57,48 @@ var opts = godog.Options{
 }
 
 func InitializeScenario(ctx *godog.ScenarioContext) {
+	ctx.BeforeScenario(resetApplication)
+
+	ctx.Step(`^there is an? "([^"]*)" resource "([^"]*)"$`, thereIsAResource)
+	ctx.Step(`^there is an? "([^"]*)" resource "([^"]*)" answering the needs "([^"]*)"$`, thereIsAResourceAnsweringTheNeeds)
+	ctx.Step(`^the description of the resource is changed to "([^"]*)"$`, theDescriptionOfTheResourceIsChangedTo)
+	ctx.Step(`^the resource is deleted$`, theResourceIsDeleted)
 	ctx.Step(`^I send "([^"]*)" request to "([^"]*)"$`, iSendRequestTo)
+	ctx.Step(`^I send "([^"]*)" request to "([^"]*)" with payload:$`, iSendRequestToWithPayload)
+	ctx.Step(`^I send "([^"]*)" request to "([^"]*)" with a payload of (\d+) bytes$`, iSendRequestToWithAPayloadOf)
+	ctx.Step(`^I follow the "([^"]*)" link$`, iFollowTheLink)
+	ctx.Step(`^I set the "([^"]*)" header to "([^"]*)"$`, iSetTheHeaderTo)
+	ctx.Step(`^I set the "([^"]*)" header to '([^']*)'$`, iSetTheHeaderTo)
 	ctx.Step(`^the response code should be (\d+)$`, theResponseCodeShouldBe)
+	ctx.Step(`^the response header "([^"]*)" should be "([^"]*)"$`, theResponseHeaderShouldBe)
+	ctx.Step(`^the response header "([^"]*)" should be '([^']*)'$`, theResponseHeaderShouldBe)
+	ctx.Step(`^the response header "([^"]*)" should match "([^"]*)"$`, theResponseHeaderShouldMatch)
+	ctx.Step(`^the response header "([^"]*)" should match '([^']*)'$`, theResponseHeaderShouldMatch)
+	ctx.Step(`^the response body should match '([^']*)'$`, theResponseBodyShouldMatch)
+	ctx.Step(`^the events "([^"]*)" should be published$`, theEventsShouldBePublished)
+	ctx.Step(`^no event should be published$`, noEventShouldBePublished)
+	ctx.Step(`^the events should carry the correlation id "([^"]*)"$`, theEventsShouldCarryTheCorrelationID)
 }
 
 func TestMain(m *testing.M) {
-	flag.Parse()
+	// go test passes its own flags as -test.name=value, the others are godog's
+	var testArgs, godogArgs []string
+
+	for _, arg := range os.Args[1:] {
+		if strings.HasPrefix(arg, "-test.") {
+			testArgs = append(testArgs, arg)
+		} else {
+			godogArgs = append(godogArgs, arg)
+		}
+	}
+
+	goflag.CommandLine.Parse(testArgs)
+	flag.CommandLine.Parse(godogArgs)
 	opts.Paths = flag.Args()
 
+	application.Initialize()
+	server = httptest.NewServer(application.Router)
+
 	status := godog.TestSuite{
 		Name: "godogs",
 		// TestSuiteInitializer: InitializeTestSuite,
@@ -49,30 +106,112 @@ func TestMain(m *testing.M) {
 		Options: &opts,
 	}.Run()
 
+	// the unit tests of the package run after the scenarios
+	if unitStatus := m.Run(); unitStatus > status {
+		status = unitStatus
+	}
+
+	server.Close()
 	os.Exit(status)
 }
 
 var res *http.Response
+var body []byte
 
-func iSendRequestTo(method, endpoint string) error {
-	client := &http.Client{}
+// created is the last resource created by a Given step, whose ID replaces
+// {id} in the requests
+var created resource.Resource
+
+// resetApplication gives every scenario the seeded resources only, and no
+// event, whatever the scenarios run before
+func resetApplication(*godog.Scenario) {
+	application.Store.Initialize()
+
+	// the outbox is not reset with the resources
+	relayEvents()
+
+	recorder = event.NewRecorder()
+	application.Events = recorder
+	published = 0
+
+	created = resource.Resource{}
+	headers = map[string]string{}
+	res = nil
+	body = nil
+}
+
+func thereIsAResource(kind, description string) error {
+	return thereIsAResourceAnsweringTheNeeds(kind, description, "")
+}
+
+func thereIsAResourceAnsweringTheNeeds(kind, description, needs string) error {
+	created = resource.Resource{Type: kind, Description: description}
+
+	for _, id := range strings.Split(needs, ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return fmt.Errorf("invalid need ID %q", id)
+		}
+
+		created.Needs = append(created.Needs, n)
+	}
+
+	if err := application.Store.CreateResource(context.Background(), &created); err != nil {
+		return fmt.Errorf("could not create the resource %s", err.Error())
+	}
+
+	// the events of the Given steps are not the ones the scenario expects
+	forgetPublishedEvents()
+
+	return nil
+}
 
-	server := fmt.Sprintf("http://%s:%s",
-		application.Config.Server.Host,
-		application.Config.Server.Port,
-	)
+func theDescriptionOfTheResourceIsChangedTo(description string) error {
+	created.Description = description
 
+	if err := application.Store.UpdateResource(context.Background(), &created); err != nil {
+		return fmt.Errorf("could not update the resource %s", err.Error())
+	}
+
+	forgetPublishedEvents()
+
+	return nil
+}
+
+func theResourceIsDeleted() error {
+	if err := application.Store.DeleteResource(context.Background(), &resource.Resource{ID: created.ID}); err != nil {
+		return fmt.Errorf("could not delete the resource %s", err.Error())
+	}
+
+	forgetPublishedEvents()
+
+	return nil
+}
+
+// headers are sent with the next request only
+var headers = map[string]string{}
+
+func iSetTheHeaderTo(name, value string) error {
+	headers[name] = value
+	return nil
+}
+
+func iSendRequestTo(method, endpoint string) error {
 	var data map[string]string
 
-	switch endpoint {
-	case "/POST":
+	switch method {
+	case "POST":
 		data = map[string]string{
-			"type": "outdoor",
+			"type": "collective",
 			"description": "Du bon gros sexe des familles !",
 		}
-	case "/PUT":
+	case "PUT":
 		data = map[string]string{
-			"id": "3",
+			"type": "collective",
 			"description": "Du bon gros sexe, mais sans la famille cette fois !",
 		}
 	default:
@@ -80,25 +219,69 @@ func iSendRequestTo(method, endpoint string) error {
 	}
 
 	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("could not encode payload %s", err.Error())
+	}
+
+	return sendRequest(method, endpoint, payload)
+}
+
+func iSendRequestToWithPayload(method, endpoint string, payload *godog.DocString) error {
+	return sendRequest(method, endpoint, []byte(payload.Content))
+}
+
+// iSendRequestToWithAPayloadOf sends a resource whose description pads the
+// payload to size bytes
+func iSendRequestToWithAPayloadOf(method, endpoint string, size int) error {
+	empty := `{"type": "individual", "description": ""}`
+	description := strings.Repeat("a", size - len(empty))
 
-  req, err := http.NewRequest(method, server+endpoint, bytes.NewBuffer(payload))
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; param=value")
+	return sendRequest(method, endpoint, []byte(`{"type": "individual", "description": "` + description + `"}`))
+}
+
+// linkPattern matches one link of a Link header, with its relation
+var linkPattern = regexp.MustCompile(`<([^>]*)>; rel="([^"]*)"`)
+
+// iFollowTheLink requests the target of a relation of the Link header of the
+// last response
+func iFollowTheLink(relation string) error {
+	for _, link := range linkPattern.FindAllStringSubmatch(res.Header.Get("Link"), -1) {
+		if link[2] == relation {
+			return sendRequest("GET", link[1], nil)
+		}
+	}
+
+	return fmt.Errorf("expected a %q link, but actual are: %q", relation, res.Header.Get("Link"))
+}
 
+func sendRequest(method, endpoint string, payload []byte) error {
+	client := &http.Client{}
+
+	endpoint = strings.Replace(endpoint, "{id}", strconv.Itoa(created.ID), -1)
+
+  req, err := http.NewRequest(method, server.URL+endpoint, bytes.NewBuffer(payload))
 	if err != nil {
 		return fmt.Errorf("could not create request %s", err.Error())
 	}
 
- 	res, err = client.Do(req)
-	defer res.Body.Close()
+	req.Header.Set("Content-Type", "application/json")
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	headers = map[string]string{}
 
+ 	res, err = client.Do(req)
 	if err != nil {
     return fmt.Errorf("could not send request %s", err.Error())
   }
 
-	// TODO find a soltion to clean database between test calls
-	// if (endpoint != "initialize_db") {
-	// 	iSendRequestTo("GET", "initialize_db")
-	// }
+	defer res.Body.Close()
+
+	if body, err = ioutil.ReadAll(res.Body); err != nil {
+		return fmt.Errorf("could not read response %s", err.Error())
+	}
 
 	return nil
 }
@@ -110,3 +293,91 @@ func theResponseCodeShouldBe(code int) error {
 
 	return nil
 }
+
+func theResponseHeaderShouldBe(name, value string) error {
+	if actual := res.Header.Get(name); actual != value {
+		return fmt.Errorf("expected response header %s to be: %q, but actual is: %q", name, value, actual)
+	}
+
+	return nil
+}
+
+func theResponseHeaderShouldMatch(name, pattern string) error {
+	matched, err := regexp.MatchString(pattern, res.Header.Get(name))
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %s", pattern, err.Error())
+	}
+
+	if !matched {
+		return fmt.Errorf("expected response header %s to match: %q, but actual is: %q", name, pattern, res.Header.Get(name))
+	}
+
+	return nil
+}
+
+func theResponseBodyShouldMatch(pattern string) error {
+	matched, err := regexp.Match(pattern, body)
+	if err != nil {
+		return fmt.Errorf("invalid pattern %q: %s", pattern, err.Error())
+	}
+
+	if !matched {
+		return fmt.Errorf("expected response body to match: %q, but actual is: %s", pattern, body)
+	}
+
+	return nil
+}
+
+// published counts the events recorded before the current scenario
+var published int
+
+func relayEvents() ([]event.Event, error) {
+	_, err := application.Store.RelayEvents(100, func(e event.Event) error {
+		return recorder.Publish(context.Background(), e)
+	})
+
+	return recorder.Events(), err
+}
+
+func forgetPublishedEvents() {
+	events, _ := relayEvents()
+	published = len(events)
+}
+
+func theEventsShouldBePublished(types string) error {
+	events, err := relayEvents()
+	if err != nil {
+		return fmt.Errorf("could not relay the events %s", err.Error())
+	}
+
+	var actual []string
+
+	for _, e := range events[published:] {
+		actual = append(actual, e.Type)
+	}
+
+	if strings.Join(actual, ", ") != types {
+		return fmt.Errorf("expected the events %q to be published, but actual are: %q", types, strings.Join(actual, ", "))
+	}
+
+	return nil
+}
+
+func noEventShouldBePublished() error {
+	return theEventsShouldBePublished("")
+}
+
+func theEventsShouldCarryTheCorrelationID(id string) error {
+	events, err := relayEvents()
+	if err != nil {
+		return fmt.Errorf("could not relay the events %s", err.Error())
+	}
+
+	for _, e := range events[published:] {
+		if e.CorrelationID != id {
+			return fmt.Errorf("expected the event %s to carry the correlation id: %q, but actual is: %q", e.Type, id, e.CorrelationID)
+		}
+	}
+
+	return nil
+}
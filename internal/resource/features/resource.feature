@@ -3,22 +3,598 @@ Feature: manage resources
   I want to be able to make CRUD operations in a database through an API endpoint
   So I can have manage my available resources to answer my needs and feed my strategies
 
+  # every scenario starts from the seeded resources 1 and 2 only, the ones it
+  # creates get the next IDs and the last one is requested as {id}
+
   Scenario: doing a valid query to create a resource
     When I send "POST" request to "/resource"
     Then the response code should be 201
+    And the events "resource.created" should be published
 
   Scenario: doing a valid query to delete a resource
-    When I send "DELETE" request to "/resource/2"
+    Given there is a "collective" resource "faire une séance de biodanza"
+    When I send "DELETE" request to "/resource/{id}"
     Then the response code should be 200
+    And the events "resource.deleted" should be published
 
   Scenario: doing a valid query to fetch a list of resources
+    Given there is an "individual" resource "faire une sieste"
     When I send "GET" request to "/resources"
     Then the response code should be 200
+    And the response header "X-Total-Count" should be "3"
 
   Scenario: doing a valid query to fetch a resource
-    When I send "GET" request to "/resource/1"
+    Given there is an "individual" resource "faire une sieste"
+    When I send "GET" request to "/resource/{id}"
     Then the response code should be 200
+    And the response header "ETag" should be '"1"'
 
   Scenario: doing a valid query to update a resource
-    When I send "PUT" request to "/resource/1"
+    Given there is an "individual" resource "faire une sieste"
+    When I send "PUT" request to "/resource/{id}"
+    Then the response code should be 200
+    And the events "resource.updated" should be published
+    And the response header "ETag" should be '"2"'
+
+  Scenario: doing a maintenance query without the admin credential
+    When I send "POST" request to "/initialize_db"
+    Then the response code should be 401
+
+  Scenario: doing a maintenance query with the GET method
+    When I send "GET" request to "/initialize_db"
+    Then the response code should be 405
+    And the response header "Content-Type" should be "application/problem+json"
+    And the response header "Allow" should be "POST"
+    And the response header "X-Correlation-ID" should match "^[0-9a-f]{32}$"
+
+  Scenario: doing a query to a path no route matches
+    When I send "GET" request to "/unknown"
+    Then the response code should be 404
+    And the response header "Content-Type" should be "application/problem+json"
+    And the response header "X-Correlation-ID" should match "^[0-9a-f]{32}$"
+
+  Scenario: doing a valid query to fetch a page of resources
+    Given there is an "individual" resource "faire une sieste"
+    When I send "GET" request to "/resources?limit=1"
+    Then the response code should be 200
+    And the response header "X-Total-Count" should be "3"
+    And the response header "Link" should match '^</resources\?limit=1>; rel="first", </resources\?cursor=[A-Za-z0-9_-]+&limit=1>; rel="next", </resources\?cursor=[A-Za-z0-9_-]+&limit=1>; rel="last"$'
+
+  Scenario: doing a query to fetch resources with an invalid cursor
+    When I send "GET" request to "/resources?cursor=invalid"
+    Then the response code should be 400
+
+  Scenario: doing a query to fetch resources with a last cursor which is not backward
+    When I send "GET" request to "/resources?cursor=eyJsYXN0Ijp0cnVlfQ"
+    Then the response code should be 400
+
+  Scenario: doing a query to fetch resources with a last cursor carrying a key
+    When I send "GET" request to "/resources?cursor=eyJrZXkiOlsxXSwiYmFja3dhcmQiOnRydWUsImxhc3QiOnRydWV9"
+    Then the response code should be 400
+
+  Scenario: doing a query to fetch resources with a too large page
+    When I send "GET" request to "/resources?limit=1000"
+    Then the response code should be 400
+
+  Scenario: doing a valid query to fetch the last page of resources without total
+    Given there is an "individual" resource "faire une sieste"
+    When I send "GET" request to "/resources?cursor=eyJiYWNrd2FyZCI6dHJ1ZSwibGFzdCI6dHJ1ZX0&include_total=false"
+    Then the response code should be 200
+    And the response header "X-Total-Count" should be ""
+    And the response header "Link" should match 'rel="first", .*rel="last"$'
+
+  Scenario: doing a valid query to fetch resources filtered by type
+    Given there is an "individual" resource "faire une sieste"
+    And there is a "collective" resource "faire une séance de biodanza"
+    When I send "GET" request to "/resources?type=collective"
+    Then the response code should be 200
+    And the response body should match '^{"items":\[{"id":2,"type":"collective",[^}]*},{"id":4,"type":"collective",[^}]*}\],"has_more":false,"total":2}$'
+
+  Scenario: doing a valid query to fetch resources filtered by several types
+    Given there is an "individual" resource "faire une sieste"
+    When I send "GET" request to "/resources?type=individual,collective"
+    Then the response code should be 200
+    And the response body should match '^{"items":\[{"id":1,"type":"individual",[^}]*},{"id":2,"type":"collective",[^}]*},{"id":3,"type":"individual",[^}]*}\],"has_more":false,"total":3}$'
+
+  Scenario: doing a valid query to fetch resources with a filter expression
+    Given there is an "individual" resource "faire une longue sieste"
+    When I send "GET" request to "/resources?filter=description%20contains%20'sieste'%20and%20id%20%3E%3D%202"
+    Then the response code should be 200
+    And the response body should match '^{"items":\[{"id":3,"type":"individual","description":"faire une longue sieste",[^}]*}\],"has_more":false,"total":1}$'
+
+  Scenario: doing a valid query to fetch the pages of resources with a filter expression
+    Given there is an "individual" resource "faire une longue sieste"
+    And there is a "collective" resource "faire une séance de biodanza"
+    When I send "GET" request to "/resources?filter=description%20contains%20'sieste'&limit=1"
+    Then the response code should be 200
+    And the response body should match '^{"items":\[{"id":1,[^}]*}\],"next_cursor":"[A-Za-z0-9_-]+","has_more":true,"total":2}$'
+    When I follow the "next" link
+    Then the response code should be 200
+    And the response body should match '^{"items":\[{"id":3,[^}]*}\],"prev_cursor":"[A-Za-z0-9_-]+","has_more":false,"total":2}$'
+
+  Scenario: doing a query to fetch resources with an invalid filter expression
+    When I send "GET" request to "/resources?filter=unknown%20%3D%201"
+    Then the response code should be 400
+
+  Scenario: doing a valid query to fetch resources sorted by several fields
+    Given there is an "individual" resource "faire une sieste"
+    And there is a "collective" resource "faire une séance de biodanza"
+    When I send "GET" request to "/resources?sort=type,-id"
+    Then the response code should be 200
+    And the response body should match '^{"items":\[{"id":4,"type":"collective",[^}]*},{"id":2,"type":"collective",[^}]*},{"id":3,"type":"individual",[^}]*},{"id":1,"type":"individual",[^}]*}\],'
+
+  Scenario: doing a valid query to fetch resources sorted by several fields in the other direction
+    Given there is an "individual" resource "faire une sieste"
+    And there is a "collective" resource "faire une séance de biodanza"
+    When I send "GET" request to "/resources?sort=-type,id"
+    Then the response code should be 200
+    And the response body should match '^{"items":\[{"id":1,"type":"individual",[^}]*},{"id":3,"type":"individual",[^}]*},{"id":2,"type":"collective",[^}]*},{"id":4,"type":"collective",[^}]*}\],'
+
+  Scenario: doing a valid query to fetch the pages of resources sorted by several fields
+    Given there is an "individual" resource "faire une sieste"
+    And there is a "collective" resource "faire une séance de biodanza"
+    When I send "GET" request to "/resources?sort=type,-id&limit=1"
+    Then the response code should be 200
+    And the response body should match '^{"items":\[{"id":4,[^}]*}\],'
+    When I follow the "next" link
+    Then the response code should be 200
+    And the response body should match '^{"items":\[{"id":2,[^}]*}\],'
+
+  Scenario: doing a query to fetch resources sorted by an unknown field
+    When I send "GET" request to "/resources?sort=-unknown"
+    Then the response code should be 400
+
+  Scenario: doing a query to fetch resources sorted by a field which cannot be sorted
+    When I send "GET" request to "/resources?sort=version"
+    Then the response code should be 400
+    And the response header "Content-Type" should be "application/problem+json"
+    And the response body should match '"detail":"[^"]*cannot sort on field \\"version\\"'
+
+  Scenario: doing a query to fetch resources sorted by an injected expression
+    When I send "GET" request to "/resources?sort=id%3BDROP%20TABLE%20resources"
+    Then the response code should be 400
+
+  Scenario: doing a valid query to search resources in French
+    Given there is a "collective" resource "un atelier de méditation & <yoga>"
+    When I send "GET" request to "/resources/search?q=meditation"
+    Then the response code should be 200
+    And the response body should match '^{"items":\[{"id":3,"type":"collective",[^}]*"snippet":"un atelier de \\u003cmark\\u003eméditation\\u003c/mark\\u003e \\u0026amp; \\u0026lt;yoga\\u0026gt;"}\]}$'
+
+  Scenario: doing a valid query to search resources in French with several matches
+    Given there is an "individual" resource "une séance de sieste après la séance de biodanza"
+    When I send "GET" request to "/resources/search?q=séance%20biodanza"
+    Then the response code should be 200
+    And the response body should match '^{"items":\[{"id":2,[^}]*},{"id":3,[^}]*"snippet":"une \\u003cmark\\u003eséance\\u003c/mark\\u003e de sieste après la \\u003cmark\\u003eséance\\u003c/mark\\u003e de \\u003cmark\\u003ebiodanza\\u003c/mark\\u003e"}\]}$'
+
+  Scenario: doing a query to search resources without terms
+    When I send "GET" request to "/resources/search?q="
+    Then the response code should be 400
+
+  Scenario: doing a query to create a resource without type
+    When I send "POST" request to "/resource" with payload:
+      """
+      {"description": "faire une sieste"}
+      """
+    Then the response code should be 422
+
+  Scenario: doing a query to create a resource with an unknown type
+    When I send "POST" request to "/resource" with payload:
+      """
+      {"type": "outdoor", "description": "faire une sieste"}
+      """
+    Then the response code should be 422
+
+  Scenario: doing a query to create a resource with an unknown field
+    When I send "POST" request to "/resource" with payload:
+      """
+      {"type": "individual", "description": "faire une sieste", "unknown": 3}
+      """
+    Then the response code should be 422
+
+  Scenario: doing a query to create a resource with several problems
+    When I send "POST" request to "/resource" with payload:
+      """
+      {"type": "individual", "unknown": 3, "colour": "red", "needs": "3", "id": 42}
+      """
+    Then the response code should be 422
+    And the response body should match '"errors":\[{"field":"colour","message":"is not a known field"},{"field":"needs","message":"must be an array"},{"field":"unknown","message":"is not a known field"},{"field":"id","message":"is read-only"},{"field":"description","message":"is required"}\]'
+
+  Scenario: doing a query to create a resource with a payload too large
+    When I send "POST" request to "/resource" with a payload of 2000000 bytes
+    Then the response code should be 413
+    And the response header "Content-Type" should be "application/problem+json"
+    And no event should be published
+
+  Scenario: doing a query to update a resource with a malformed payload
+    Given there is an "individual" resource "faire une sieste"
+    When I send "PUT" request to "/resource/{id}" with payload:
+      """
+      {"type": "individual",
+      """
+    Then the response code should be 400
+
+  Scenario: doing a query to create a resource with a payload which is not an object
+    When I send "POST" request to "/resource" with payload:
+      """
+      [1, 2]
+      """
+    Then the response code should be 400
+
+  Scenario: doing a query to create a resource with data after the payload
+    When I send "POST" request to "/resource" with payload:
+      """
+      {"type": "individual", "description": "faire une sieste"} {}
+      """
+    Then the response code should be 400
+
+  Scenario: doing a query to create a resource with its ID
+    When I send "POST" request to "/resource" with payload:
+      """
+      {"id": 42, "type": "individual", "description": "faire une sieste"}
+      """
+    Then the response code should be 422
+
+  Scenario: doing a query to update a resource with its version
+    Given there is an "individual" resource "faire une sieste"
+    When I send "PUT" request to "/resource/{id}" with payload:
+      """
+      {"type": "individual", "description": "faire une sieste", "version": 1}
+      """
+    Then the response code should be 422
+
+  Scenario: doing a query to get a resource which does not exist
+    When I send "GET" request to "/resource/999"
+    Then the response code should be 404
+    And the response header "Content-Type" should be "application/problem+json"
+
+  Scenario: doing a query with a correlation identifier
+    Given I set the "X-Correlation-ID" header to "a-correlation-id"
+    When I send "GET" request to "/resource/999"
+    Then the response code should be 404
+    And the response header "X-Correlation-ID" should be "a-correlation-id"
+
+  Scenario: doing a valid query to change a resource with a correlation identifier
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "X-Correlation-ID" header to "a-change-id"
+    And I set the "Content-Type" header to "application/merge-patch+json"
+    When I send "PATCH" request to "/resource/{id}" with payload:
+      """
+      {"description": "faire une longue sieste"}
+      """
+    Then the response code should be 200
+    And the events "resource.updated" should be published
+    And the events should carry the correlation id "a-change-id"
+
+  Scenario: doing a query to update a resource which does not exist
+    When I send "PUT" request to "/resource/999"
+    Then the response code should be 404
+    And no event should be published
+
+  Scenario: doing a query to delete a resource which does not exist
+    When I send "DELETE" request to "/resource/999"
+    Then the response code should be 404
+
+  Scenario: doing a query to delete a resource which is already deleted
+    Given there is an "individual" resource "faire une sieste"
+    And the resource is deleted
+    When I send "DELETE" request to "/resource/{id}"
+    Then the response code should be 404
+    And no event should be published
+
+  Scenario: doing a valid query to merge a patch into a resource
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "Content-Type" header to "application/merge-patch+json"
+    When I send "PATCH" request to "/resource/{id}" with payload:
+      """
+      {"description": "faire une longue sieste"}
+      """
+    Then the response code should be 200
+
+  Scenario: doing a valid query to apply a JSON patch to a resource
+    Given there is a "collective" resource "faire une longue sieste"
+    And I set the "Content-Type" header to "application/json-patch+json"
+    When I send "PATCH" request to "/resource/{id}" with payload:
+      """
+      [
+        {"op": "test", "path": "/description", "value": "faire une longue sieste"},
+        {"op": "replace", "path": "/type", "value": "individual"}
+      ]
+      """
+    Then the response code should be 200
+
+  Scenario: doing a query to patch a resource with a failing test operation
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "Content-Type" header to "application/json-patch+json"
+    When I send "PATCH" request to "/resource/{id}" with payload:
+      """
+      [{"op": "test", "path": "/type", "value": "collective"}]
+      """
+    Then the response code should be 409
+
+  Scenario: doing a query to patch a resource into an invalid one
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "Content-Type" header to "application/merge-patch+json"
+    When I send "PATCH" request to "/resource/{id}" with payload:
+      """
+      {"type": null}
+      """
+    Then the response code should be 422
+
+  Scenario: doing a query to patch a resource with several problems
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "Content-Type" header to "application/merge-patch+json"
+    When I send "PATCH" request to "/resource/{id}" with payload:
+      """
+      {"type": 5, "colour": "red", "id": "seven", "description": ""}
+      """
+    Then the response code should be 422
+    And the response body should match '"errors":\[{"field":"colour","message":"is not a known field"},{"field":"id","message":"must be an integer"},{"field":"type","message":"must be a string"},{"field":"description","message":"is required"}\]'
+
+  Scenario: doing a query to patch the ID of a resource
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "Content-Type" header to "application/json-patch+json"
+    When I send "PATCH" request to "/resource/{id}" with payload:
+      """
+      [{"op": "replace", "path": "/id", "value": 7}]
+      """
+    Then the response code should be 422
+
+  Scenario: doing a query to patch a resource with a plain JSON payload
+    Given there is an "individual" resource "faire une sieste"
+    When I send "PATCH" request to "/resource/{id}" with payload:
+      """
+      {"description": "faire une sieste"}
+      """
+    Then the response code should be 415
+
+  Scenario: doing a query to patch a resource which does not exist
+    Given I set the "Content-Type" header to "application/merge-patch+json"
+    When I send "PATCH" request to "/resource/999" with payload:
+      """
+      {"description": "faire une sieste"}
+      """
+    Then the response code should be 404
+
+  Scenario: doing a query to fetch a resource which has not changed
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "If-None-Match" header to '"1"'
+    When I send "GET" request to "/resource/{id}"
+    Then the response code should be 304
+    And the response header "ETag" should be '"1"'
+
+  Scenario: doing a query to update a resource from an outdated version
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "If-Match" header to '"7"'
+    When I send "PUT" request to "/resource/{id}"
+    Then the response code should be 412
+    And the response header "Content-Type" should be "application/problem+json"
+
+  Scenario: doing a valid query to update a resource from its current version
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "If-Match" header to '"1"'
+    When I send "PUT" request to "/resource/{id}"
+    Then the response code should be 200
+    And the response header "ETag" should be '"2"'
+
+  Scenario: doing a query to patch a resource from an outdated version
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "If-Match" header to '"2"'
+    And I set the "Content-Type" header to "application/merge-patch+json"
+    When I send "PATCH" request to "/resource/{id}" with payload:
+      """
+      {"description": "faire une longue sieste"}
+      """
+    Then the response code should be 412
+
+  Scenario: doing a query to delete a resource with a weak entity tag
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "If-Match" header to 'W/"1"'
+    When I send "DELETE" request to "/resource/{id}"
+    Then the response code should be 412
+
+  Scenario: doing a valid query to delete a resource from one of several versions
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "If-Match" header to '"1", "2"'
+    When I send "DELETE" request to "/resource/{id}"
+    Then the response code should be 200
+
+  Scenario: doing a valid query to fetch the resources updated since a date
+    Given there is an "individual" resource "faire une sieste"
+    When I send "GET" request to "/resources?updated_since=2021-01-01T00:00:00Z"
+    Then the response code should be 200
+
+  Scenario: doing a query to fetch the resources updated since an invalid date
+    When I send "GET" request to "/resources?updated_since=yesterday"
+    Then the response code should be 400
+
+  Scenario: doing a valid query to fetch resources filtered and sorted by audit fields
+    Given there is an "individual" resource "faire une sieste"
+    When I send "GET" request to "/resources?filter=created_by%20%3D%20system&sort=-updated_at,created_by&limit=1"
+    Then the response code should be 200
+
+  Scenario: doing a query to patch the creator of a resource
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "Content-Type" header to "application/merge-patch+json"
+    When I send "PATCH" request to "/resource/{id}" with payload:
+      """
+      {"created_by": "someone"}
+      """
+    Then the response code should be 422
+
+  Scenario: doing a valid query to fetch the deleted resources
+    Given there is an "individual" resource "faire une sieste"
+    And the resource is deleted
+    When I send "GET" request to "/resources/trash?limit=1&include_total=true"
+    Then the response code should be 200
+    And the response header "X-Total-Count" should be "1"
+
+  Scenario: doing a query to fetch a deleted resource
+    Given there is an "individual" resource "faire une sieste"
+    And the resource is deleted
+    When I send "GET" request to "/resource/{id}"
+    Then the response code should be 404
+
+  Scenario: doing a valid query to restore a deleted resource
+    Given there is a "collective" resource "faire une séance de biodanza"
+    And the resource is deleted
+    When I send "POST" request to "/resource/{id}/restore"
+    Then the response code should be 200
+    And the events "resource.updated" should be published
+
+  Scenario: doing a query to restore a resource which is not deleted
+    Given there is an "individual" resource "faire une sieste"
+    When I send "POST" request to "/resource/{id}/restore"
+    Then the response code should be 404
+    And no event should be published
+
+  Scenario: doing a query to restore a resource from an outdated version
+    Given there is an "individual" resource "faire une sieste"
+    And the resource is deleted
+    And I set the "If-Match" header to '"1"'
+    When I send "POST" request to "/resource/{id}/restore"
+    Then the response code should be 412
+
+  Scenario: doing a valid query to restore a deleted resource from one of several versions
+    Given there is an "individual" resource "faire une sieste"
+    And the resource is deleted
+    And I set the "If-Match" header to '"1", "2"'
+    When I send "POST" request to "/resource/{id}/restore"
+    Then the response code should be 200
+    And the response header "ETag" should be '"3"'
+    And the events "resource.updated" should be published
+
+  Scenario: doing a query to restore a deleted resource from several outdated versions
+    Given there is an "individual" resource "faire une sieste"
+    And the resource is deleted
+    And I set the "If-Match" header to '"1", "5"'
+    When I send "POST" request to "/resource/{id}/restore"
+    Then the response code should be 412
+    And no event should be published
+
+  Scenario: doing a query to restore a resource which is not deleted from several versions
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "If-Match" header to '"1", "2"'
+    When I send "POST" request to "/resource/{id}/restore"
+    Then the response code should be 404
+
+  Scenario: doing a valid query to fetch the history of a resource
+    Given there is an "individual" resource "faire une sieste"
+    And the description of the resource is changed to "faire une longue sieste"
+    When I send "GET" request to "/resource/{id}/history"
+    Then the response code should be 200
+    And the response body should match '^{"items":\[{"resource_id":3,"revision":2,"operation":"updated",.*"changes":\[{"field":"description","from":"faire une sieste","to":"faire une longue sieste"}\]},{"resource_id":3,"revision":1,"operation":"created",.*"changes":\[{"field":"type","from":"","to":"individual"},{"field":"description","from":"","to":"faire une sieste"}\]}\]}$'
+
+  Scenario: doing a valid query to fetch a revision of a resource
+    Given there is an "individual" resource "faire une sieste"
+    When I send "GET" request to "/resource/{id}/history/1"
+    Then the response code should be 200
+    And the response body should match '^{"resource_id":3,"revision":1,"operation":"created",.*"resource":{"id":3,"type":"individual","description":"faire une sieste",[^}]*"version":1,.*"changes":\[{"field":"type","from":"","to":"individual"},{"field":"description","from":"","to":"faire une sieste"}\]}$'
+
+  Scenario: doing a valid query to fetch a revision changing a resource
+    Given there is an "individual" resource "faire une sieste"
+    And the description of the resource is changed to "faire une longue sieste"
+    When I send "GET" request to "/resource/{id}/history/2"
+    Then the response code should be 200
+    And the response body should match '^{"resource_id":3,"revision":2,"operation":"updated",.*"resource":{"id":3,"type":"individual","description":"faire une longue sieste",[^}]*"version":2,.*"changes":\[{"field":"description","from":"faire une sieste","to":"faire une longue sieste"}\]}$'
+
+  Scenario: doing a query to fetch a revision which does not exist
+    Given there is an "individual" resource "faire une sieste"
+    When I send "GET" request to "/resource/{id}/history/999"
+    Then the response code should be 404
+
+  Scenario: doing a query to fetch the history of a resource which does not exist
+    When I send "GET" request to "/resource/999/history"
+    Then the response code should be 404
+
+  Scenario: doing a valid query to revert a resource to a revision
+    Given there is an "individual" resource "faire une sieste"
+    And the description of the resource is changed to "faire une longue sieste"
+    When I send "POST" request to "/resource/{id}/history/1/revert"
+    Then the response code should be 200
+    And the response header "ETag" should be '"3"'
+    And the response body should match '^{"id":3,"type":"individual","description":"faire une sieste",[^}]*"version":3,'
+    And the events "resource.updated" should be published
+    When I send "GET" request to "/resource/{id}"
+    Then the response code should be 200
+    And the response header "ETag" should be '"3"'
+    And the response body should match '"description":"faire une sieste",[^}]*"version":3,'
+    When I send "GET" request to "/resource/{id}/history/3"
+    Then the response code should be 200
+    And the response body should match '^{"resource_id":3,"revision":3,"operation":"reverted",.*"changes":\[{"field":"description","from":"faire une longue sieste","to":"faire une sieste"}\]}$'
+
+  Scenario: doing a query to revert a deleted resource
+    Given there is an "individual" resource "faire une sieste"
+    And the resource is deleted
+    When I send "POST" request to "/resource/{id}/history/1/revert"
+    Then the response code should be 404
+
+  Scenario: doing a valid query to link a resource to a need
+    Given there is an "individual" resource "faire une sieste"
+    When I send "PUT" request to "/resource/{id}/need/2"
+    Then the response code should be 200
+
+  Scenario: doing a query to link a resource to a need which does not exist
+    Given there is an "individual" resource "faire une sieste"
+    When I send "PUT" request to "/resource/{id}/need/999"
+    Then the response code should be 422
+
+  Scenario: doing a query to patch a resource with a need which does not exist
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "Content-Type" header to "application/merge-patch+json"
+    When I send "PATCH" request to "/resource/{id}" with payload:
+      """
+      {"needs": [2, 999]}
+      """
+    Then the response code should be 422
+
+  Scenario: doing a valid query to patch the needs of a resource
+    Given there is an "individual" resource "faire une sieste"
+    And I set the "Content-Type" header to "application/merge-patch+json"
+    When I send "PATCH" request to "/resource/{id}" with payload:
+      """
+      {"needs": [2, 3]}
+      """
+    Then the response code should be 200
+
+  Scenario: doing a valid query to create a resource answering needs
+    When I send "POST" request to "/resource" with payload:
+      """
+      {"type": "collective", "description": "a shared garden", "needs": [1, 3]}
+      """
+    Then the response code should be 201
+
+  Scenario: doing a query to create a resource answering a need which does not exist
+    When I send "POST" request to "/resource" with payload:
+      """
+      {"type": "collective", "description": "a shared garden", "needs": [1, 999]}
+      """
+    Then the response code should be 422
+
+  Scenario: doing a valid query to fetch the resources answering a need
+    Given there is a "collective" resource "a shared garden" answering the needs "1, 3"
+    And there is an "individual" resource "faire une sieste" answering the needs "2"
+    When I send "GET" request to "/need/1/resources"
+    Then the response code should be 200
+    And the response body should match '^{"items":\[{"id":3,"type":"collective","description":"a shared garden",[^}]*"needs":\[1,3\][^}]*}\],"has_more":false,"total":1}$'
+
+  Scenario: doing a valid query to unlink a resource from a need
+    Given there is an "individual" resource "faire une sieste" answering the needs "2"
+    When I send "DELETE" request to "/resource/{id}/need/2"
+    Then the response code should be 200
+
+  Scenario: doing a query to unlink a resource from a need it is not linked to
+    Given there is an "individual" resource "faire une sieste"
+    When I send "DELETE" request to "/resource/{id}/need/2"
+    Then the response code should be 404
+
+  Scenario: doing a maintenance dry-run counting the deleted resources
+    Given there is an "individual" resource "faire une sieste"
+    And there is a "collective" resource "faire une séance de biodanza"
+    And the resource is deleted
+    And I set the "Authorization" header to "Bearer test"
+    When I send "POST" request to "/initialize_db" with payload:
+      """
+      {"dry_run": true}
+      """
     Then the response code should be 200
+    And the response body should match '"deleted":4,'
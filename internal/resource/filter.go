@@ -0,0 +1,416 @@
+package resource
+
+import (
+  fmt     "fmt"
+  json    "encoding/json"
+  strconv "strconv"
+  strings "strings"
+  time    "time"
+  unicode "unicode"
+)
+
+type fieldKind int
+
+const (
+  intField fieldKind = iota
+  stringField
+  timeField
+)
+
+// field describes a resource attribute which can be queried
+type field struct {
+  column   string
+  kind     fieldKind
+  sortable bool
+  value    func(Resource) interface{}
+}
+
+var fields = map[string]field{
+  "id": {
+    column: "id", kind: intField, sortable: true,
+    value: func(r Resource) interface{} { return r.ID },
+  },
+  "type": {
+    column: "type", kind: stringField, sortable: true,
+    value: func(r Resource) interface{} { return r.Type },
+  },
+  "description": {
+    column: "description", kind: stringField, sortable: true,
+    value: func(r Resource) interface{} { return r.Description },
+  },
+  "created_at": {
+    column: "created_at", kind: timeField, sortable: true,
+    value: func(r Resource) interface{} { return r.CreatedAt },
+  },
+  "updated_at": {
+    column: "updated_at", kind: timeField, sortable: true,
+    value: func(r Resource) interface{} { return r.UpdatedAt },
+  },
+  "created_by": {
+    column: "created_by", kind: stringField, sortable: true,
+    value: func(r Resource) interface{} { return r.CreatedBy },
+  },
+  "updated_by": {
+    column: "updated_by", kind: stringField, sortable: true,
+    value: func(r Resource) interface{} { return r.UpdatedBy },
+  },
+}
+
+// fromJSON converts a value decoded with json.Decoder.UseNumber to the kind
+// of the field
+func (f field) fromJSON(value interface{}) (interface{}, error) {
+  switch f.kind {
+  case intField:
+    number, ok := value.(json.Number)
+    if !ok {
+      return nil, fmt.Errorf("%v is not a number", value)
+    }
+    n, err := number.Int64()
+    return int(n), err
+  case timeField:
+    text, ok := value.(string)
+    if !ok {
+      return nil, fmt.Errorf("%v is not a timestamp", value)
+    }
+    return time.Parse(time.RFC3339Nano, text)
+  default:
+    text, ok := value.(string)
+    if !ok {
+      return nil, fmt.Errorf("%v is not a string", value)
+    }
+    return text, nil
+  }
+}
+
+// Condition restricts a listing to the resources whose Field compares to the
+// Values with the Operator, one of = != < <= > >= in contains
+type Condition struct {
+  Field    string
+  Operator string
+  Values   []interface{}
+}
+
+// Filter is a list of conditions which must all be satisfied
+type Filter []Condition
+
+// FilterError reports an invalid filter expression
+type FilterError struct {
+  Message string
+}
+
+func (e *FilterError) Error() string {
+  return "invalid filter: " + e.Message
+}
+
+func filterError(format string, args ...interface{}) error {
+  return &FilterError{Message: fmt.Sprintf(format, args...)}
+}
+
+var operatorsByKind = map[fieldKind][]string{
+  intField: {"=", "!=", "<", "<=", ">", ">=", "in"},
+  stringField: {"=", "!=", "in", "contains"},
+  timeField: {"=", "!=", "<", "<=", ">", ">="},
+}
+
+// NewCondition checks and converts the raw values of a condition
+func NewCondition(name, operator string, values []string) (Condition, error) {
+  f, found := fields[name]
+  if !found {
+    return Condition{}, filterError("unknown field %q", name)
+  }
+
+  allowed := false
+  for _, o := range operatorsByKind[f.kind] {
+    allowed = allowed || o == operator
+  }
+
+  if !allowed {
+    return Condition{}, filterError("operator %q is not allowed on field %q", operator, name)
+  }
+
+  if len(values) == 0 || (operator != "in" && len(values) != 1) {
+    return Condition{}, filterError("wrong number of values for field %q", name)
+  }
+
+  condition := Condition{Field: name, Operator: operator}
+
+  for _, value := range values {
+    switch f.kind {
+    case intField:
+      n, err := strconv.Atoi(value)
+      if err != nil {
+        return Condition{}, filterError("field %q expects integers, got %q", name, value)
+      }
+      condition.Values = append(condition.Values, n)
+    case timeField:
+      t, err := time.Parse(time.RFC3339Nano, value)
+      if err != nil {
+        return Condition{}, filterError("field %q expects RFC 3339 timestamps, got %q", name, value)
+      }
+      condition.Values = append(condition.Values, t)
+    default:
+      condition.Values = append(condition.Values, value)
+    }
+  }
+
+  return condition, nil
+}
+
+// ParseFilter parses an expression like
+//
+//   type in (individual, collective) and description contains 'sieste' and id >= 2
+//
+// made of conditions joined by "and"; string values may be quoted with ' or "
+func ParseFilter(expression string) (Filter, error) {
+  tokens, err := tokenize(expression)
+  if err != nil {
+    return nil, err
+  }
+
+  filter := Filter{}
+  position := 0
+
+  next := func() (filterToken, bool) {
+    if position >= len(tokens) {
+      return filterToken{}, false
+    }
+    position++
+    return tokens[position - 1], true
+  }
+
+  for {
+    name, ok := next()
+    if !ok || name.quoted || name.symbol {
+      return nil, filterError("a field name is expected")
+    }
+
+    operator, ok := next()
+    if !ok {
+      return nil, filterError("an operator is expected after %q", name.text)
+    }
+
+    op := strings.ToLower(operator.text)
+    var values []string
+
+    if op == "in" && !operator.quoted {
+      if open, ok := next(); !ok || !open.is("(") {
+        return nil, filterError("\"(\" is expected after \"in\"")
+      }
+
+      for {
+        value, ok := next()
+        if !ok || value.symbol {
+          return nil, filterError("a value is expected in the list of %q", name.text)
+        }
+        values = append(values, value.text)
+
+        separator, ok := next()
+        if !ok {
+          return nil, filterError("\")\" is expected to close the list of %q", name.text)
+        }
+        if separator.is(")") {
+          break
+        }
+        if !separator.is(",") {
+          return nil, filterError("\",\" or \")\" is expected in the list of %q", name.text)
+        }
+      }
+    } else {
+      if !(operator.symbol || (op == "contains" && !operator.quoted)) {
+        return nil, filterError("unknown operator %q", operator.text)
+      }
+
+      value, ok := next()
+      if !ok || value.symbol {
+        return nil, filterError("a value is expected after %q", operator.text)
+      }
+      values = append(values, value.text)
+    }
+
+    condition, err := NewCondition(name.text, op, values)
+    if err != nil {
+      return nil, err
+    }
+    filter = append(filter, condition)
+
+    conjunction, ok := next()
+    if !ok {
+      return filter, nil
+    }
+    if conjunction.quoted || strings.ToLower(conjunction.text) != "and" {
+      return nil, filterError("\"and\" is expected, got %q", conjunction.text)
+    }
+  }
+}
+
+type filterToken struct {
+  text   string
+  quoted bool
+  symbol bool
+}
+
+func (t filterToken) is(symbol string) bool {
+  return t.symbol && t.text == symbol
+}
+
+func tokenize(expression string) ([]filterToken, error) {
+  var tokens []filterToken
+  runes := []rune(expression)
+
+  for i := 0; i < len(runes); {
+    c := runes[i]
+
+    switch {
+    case unicode.IsSpace(c):
+      i++
+    case c == '\'' || c == '"':
+      var text []rune
+      closed := false
+
+      for i++; i < len(runes); i++ {
+        if runes[i] == c {
+          // a doubled quote stands for the quote itself
+          if i + 1 < len(runes) && runes[i + 1] == c {
+            text = append(text, c)
+            i++
+            continue
+          }
+          closed = true
+          i++
+          break
+        }
+        text = append(text, runes[i])
+      }
+
+      if !closed {
+        return nil, filterError("unterminated string")
+      }
+      tokens = append(tokens, filterToken{text: string(text), quoted: true})
+    case strings.ContainsRune("(),", c):
+      tokens = append(tokens, filterToken{text: string(c), symbol: true})
+      i++
+    case strings.ContainsRune("=!<>", c):
+      operator := string(c)
+      if i + 1 < len(runes) && runes[i + 1] == '=' {
+        operator += "="
+      }
+      if operator == "!" {
+        return nil, filterError("unknown operator \"!\"")
+      }
+      tokens = append(tokens, filterToken{text: operator, symbol: true})
+      i += len(operator)
+    default:
+      start := i
+      for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune("(),=!<>'\"", runes[i]) {
+        i++
+      }
+      tokens = append(tokens, filterToken{text: string(runes[start:i])})
+    }
+  }
+
+  return tokens, nil
+}
+
+// match evaluates the filter against a resource, as the SQL stores do
+func (f Filter) match(r Resource) bool {
+  for _, c := range f {
+    if !c.match(fields[c.Field].value(r)) {
+      return false
+    }
+  }
+
+  return true
+}
+
+func (c Condition) match(value interface{}) bool {
+  switch c.Operator {
+  case "in":
+    for _, v := range c.Values {
+      if compare(value, v) == 0 {
+        return true
+      }
+    }
+    return false
+  case "contains":
+    return strings.Contains(
+      strings.ToLower(value.(string)), strings.ToLower(c.Values[0].(string)))
+  }
+
+  result := compare(value, c.Values[0])
+
+  switch c.Operator {
+  case "=":
+    return result == 0
+  case "!=":
+    return result != 0
+  case "<":
+    return result < 0
+  case "<=":
+    return result <= 0
+  case ">":
+    return result > 0
+  default:
+    return result >= 0
+  }
+}
+
+// compare orders two values of the same field kind
+func compare(a, b interface{}) int {
+  switch a := a.(type) {
+  case int:
+    b := b.(int)
+    if a < b {
+      return -1
+    } else if a > b {
+      return 1
+    }
+    return 0
+  case time.Time:
+    b := b.(time.Time)
+    if a.Before(b) {
+      return -1
+    } else if a.After(b) {
+      return 1
+    }
+    return 0
+  default:
+    return strings.Compare(a.(string), b.(string))
+  }
+}
+
+// sql returns the SQL condition of the filter, its placeholders numbered from
+// len(args) + 1, and the args completed with its values
+func (f Filter) sql(args []interface{}) (string, []interface{}) {
+  var conditions []string
+
+  placeholder := func(value interface{}) string {
+    args = append(args, value)
+    return fmt.Sprintf("$%d", len(args))
+  }
+
+  for _, c := range f {
+    column := fields[c.Field].column
+
+    switch c.Operator {
+    case "in":
+      var placeholders []string
+      for _, v := range c.Values {
+        placeholders = append(placeholders, placeholder(v))
+      }
+      conditions = append(conditions,
+        fmt.Sprintf("%s IN (%s)", column, strings.Join(placeholders, ", ")))
+    case "contains":
+      conditions = append(conditions,
+        fmt.Sprintf(`%s ILIKE %s ESCAPE '\'`, column, placeholder("%" + escapeLike(c.Values[0].(string)) + "%")))
+    default:
+      conditions = append(conditions,
+        fmt.Sprintf("%s %s %s", column, c.Operator, placeholder(c.Values[0])))
+    }
+  }
+
+  return strings.Join(conditions, " AND "), args
+}
+
+func escapeLike(value string) string {
+  return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
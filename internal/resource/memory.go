@@ -0,0 +1,534 @@
+package resource
+
+import (
+  context "context"
+  event "github.com/gpenaud/needys-api-resource/internal/event"
+  log  "github.com/sirupsen/logrus"
+  sort "sort"
+  sync "sync"
+  time "time"
+)
+
+var memoryLog *log.Entry
+
+func init() {
+  memoryLog = log.WithFields(log.Fields{
+    "_file": "internal/resource/memory.go",
+    "_type": "user",
+  })
+}
+
+// MemoryStore keeps resources in memory; it is meant for tests and for
+// running the API without a database.
+type MemoryStore struct {
+  mutex     sync.RWMutex
+  // resources holds the trash as well, with DeletedAt set
+  resources map[int]Resource
+  // revisions are kept oldest first
+  revisions map[int][]Revision
+  lastID    int
+  // outbox is kept oldest first, and is not wiped by Initialize
+  outbox      []outboxEntry
+  announced   bool
+  lastEventID int
+  // serializes the relays, which deliver without holding mutex
+  relayMutex  sync.Mutex
+}
+
+type outboxEntry struct {
+  id          int
+  event       event.Event
+  publishedAt *time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+  s := &MemoryStore{}
+  s.Initialize()
+
+  return s
+}
+
+func (s *MemoryStore) Initialize() error {
+  memoryLog.Debug("reset the in-memory resources")
+
+  s.mutex.Lock()
+  s.resources = make(map[int]Resource)
+  s.revisions = make(map[int][]Revision)
+  s.lastID = 0
+  s.mutex.Unlock()
+
+  for i := range Seeds {
+    seed := Seeds[i]
+    s.CreateResource(context.Background(), &seed)
+  }
+
+  return nil
+}
+
+// now is truncated to the precision of PostgreSQL timestamps
+func now() time.Time {
+  return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func (s *MemoryStore) Ping(_ context.Context) error {
+  return nil
+}
+
+func (s *MemoryStore) GetResource(r *Resource) error {
+  s.mutex.RLock()
+  defer s.mutex.RUnlock()
+
+  stored, found := s.live(r.ID)
+  if !found {
+    return ErrNotFound
+  }
+
+  *r = stored
+
+  return nil
+}
+
+func (s *MemoryStore) GetTrashedResource(r *Resource) error {
+  s.mutex.RLock()
+  defer s.mutex.RUnlock()
+
+  stored, found := s.resources[r.ID]
+  if !found || stored.DeletedAt == nil {
+    return ErrNotFound
+  }
+
+  *r = stored
+
+  return nil
+}
+
+func (s *MemoryStore) UpdateResource(ctx context.Context, r *Resource) error {
+  c := changeOf(ctx)
+
+  s.mutex.Lock()
+  defer s.mutex.Unlock()
+
+  stored, found := s.live(r.ID)
+  if !found {
+    return ErrNotFound
+  }
+
+  if r.Version != 0 && r.Version != stored.Version {
+    return ErrVersionMismatch
+  }
+
+  r.Version = stored.Version + 1
+  r.Needs = normalizeNeeds(r.Needs)
+  r.DeletedAt = nil
+  r.CreatedAt = stored.CreatedAt
+  r.CreatedBy = stored.CreatedBy
+  r.UpdatedAt = now()
+  r.UpdatedBy = c.actor
+  s.resources[r.ID] = *r
+  s.record(*r, RevisionUpdated, c.correlationID)
+
+  return nil
+}
+
+func (s *MemoryStore) PatchResource(ctx context.Context, r *Resource, apply func(*Resource) error) error {
+  c := changeOf(ctx)
+
+  s.mutex.Lock()
+  defer s.mutex.Unlock()
+
+  current, found := s.live(r.ID)
+  if !found {
+    return ErrNotFound
+  }
+
+  if r.Version != 0 && r.Version != current.Version {
+    return ErrVersionMismatch
+  }
+
+  if err := apply(&current); err == ErrNoChange {
+    *r = s.resources[r.ID]
+    return nil
+  } else if err != nil {
+    return err
+  }
+
+  current.Needs = normalizeNeeds(current.Needs)
+  current.Version++
+  current.UpdatedAt = now()
+  current.UpdatedBy = c.actor
+  s.resources[r.ID] = current
+  s.record(current, RevisionUpdated, c.correlationID)
+  *r = current
+
+  return nil
+}
+
+func (s *MemoryStore) DeleteResource(ctx context.Context, r *Resource) error {
+  c := changeOf(ctx)
+
+  s.mutex.Lock()
+  defer s.mutex.Unlock()
+
+  stored, found := s.live(r.ID)
+  if !found {
+    return ErrNotFound
+  }
+
+  if r.Version != 0 && r.Version != stored.Version {
+    return ErrVersionMismatch
+  }
+
+  deletedAt := now()
+
+  stored.Version++
+  stored.UpdatedAt = deletedAt
+  stored.UpdatedBy = c.actor
+  stored.DeletedAt = &deletedAt
+  s.resources[r.ID] = stored
+  s.record(stored, RevisionDeleted, c.correlationID)
+  *r = stored
+
+  return nil
+}
+
+func (s *MemoryStore) RestoreResource(ctx context.Context, r *Resource) error {
+  c := changeOf(ctx)
+
+  s.mutex.Lock()
+  defer s.mutex.Unlock()
+
+  stored, found := s.resources[r.ID]
+  if !found || stored.DeletedAt == nil {
+    return ErrNotFound
+  }
+
+  if r.Version != 0 && r.Version != stored.Version {
+    return ErrVersionMismatch
+  }
+
+  stored.Version++
+  stored.UpdatedAt = now()
+  stored.UpdatedBy = c.actor
+  stored.DeletedAt = nil
+  s.resources[r.ID] = stored
+  s.record(stored, RevisionRestored, c.correlationID)
+  *r = stored
+
+  return nil
+}
+
+func (s *MemoryStore) RevertResource(ctx context.Context, r *Resource, revision int) error {
+  c := changeOf(ctx)
+
+  s.mutex.Lock()
+  defer s.mutex.Unlock()
+
+  stored, found := s.live(r.ID)
+  if !found {
+    return ErrNotFound
+  }
+
+  if r.Version != 0 && r.Version != stored.Version {
+    return ErrVersionMismatch
+  }
+
+  i := s.revisionIndex(r.ID, revision)
+  if i < 0 {
+    return ErrRevisionNotFound
+  }
+
+  target := s.revisions[r.ID][i].Resource
+
+  stored.Type = target.Type
+  stored.Description = target.Description
+  stored.Needs = normalizeNeeds(target.Needs)
+  stored.Version++
+  stored.UpdatedAt = now()
+  stored.UpdatedBy = c.actor
+  s.resources[r.ID] = stored
+  s.record(stored, RevisionReverted, c.correlationID)
+  *r = stored
+
+  return nil
+}
+
+func (s *MemoryStore) ListRevisions(id int) ([]Revision, error) {
+  s.mutex.RLock()
+  defer s.mutex.RUnlock()
+
+  if len(s.revisions[id]) == 0 {
+    return nil, ErrNotFound
+  }
+
+  revisions := append([]Revision{}, s.revisions[id]...)
+  chain(Resource{}, revisions)
+
+  return reverse(revisions), nil
+}
+
+func (s *MemoryStore) GetRevision(id, revision int) (Revision, error) {
+  s.mutex.RLock()
+  defer s.mutex.RUnlock()
+
+  if len(s.revisions[id]) == 0 {
+    return Revision{}, ErrNotFound
+  }
+
+  i := s.revisionIndex(id, revision)
+  if i < 0 {
+    return Revision{}, ErrRevisionNotFound
+  }
+
+  previous := Resource{}
+  if i > 0 {
+    previous = s.revisions[id][i - 1].Resource
+  }
+
+  revisions := []Revision{s.revisions[id][i]}
+  chain(previous, revisions)
+
+  return revisions[0], nil
+}
+
+// record appends the revision of a change, and the event announcing it when
+// the outbox is enabled, the store being locked
+func (s *MemoryStore) record(r Resource, operation, correlationID string) {
+  s.revisions[r.ID] = append(s.revisions[r.ID], newRevision(r, operation))
+
+  if !s.announced {
+    return
+  }
+
+  e, err := announce(r, operation, correlationID)
+  if err != nil {
+    memoryLog.Error("could not announce a change: ", err)
+    return
+  }
+
+  s.lastEventID++
+  s.outbox = append(s.outbox, outboxEntry{id: s.lastEventID, event: e})
+}
+
+func (s *MemoryStore) EnableOutbox() {
+  s.mutex.Lock()
+  defer s.mutex.Unlock()
+
+  s.announced = true
+}
+
+func (s *MemoryStore) RelayEvents(limit int, deliver func(event.Event) error) (int, error) {
+  s.relayMutex.Lock()
+  defer s.relayMutex.Unlock()
+
+  s.mutex.RLock()
+  var pending []outboxEntry
+
+  for _, entry := range s.outbox {
+    if entry.publishedAt == nil && len(pending) < limit {
+      pending = append(pending, entry)
+    }
+  }
+  s.mutex.RUnlock()
+
+  delivered := 0
+
+  for _, entry := range pending {
+    if err := deliver(entry.event); err != nil {
+      return delivered, err
+    }
+
+    s.mutex.Lock()
+    for i := range s.outbox {
+      if s.outbox[i].id == entry.id {
+        publishedAt := now()
+        s.outbox[i].publishedAt = &publishedAt
+      }
+    }
+    s.mutex.Unlock()
+
+    delivered++
+  }
+
+  return delivered, nil
+}
+
+func (s *MemoryStore) PurgeEvents(before time.Time) (int, error) {
+  s.mutex.Lock()
+  defer s.mutex.Unlock()
+
+  kept := s.outbox[:0]
+
+  for _, entry := range s.outbox {
+    if entry.publishedAt == nil || !entry.publishedAt.Before(before) {
+      kept = append(kept, entry)
+    }
+  }
+
+  purged := len(s.outbox) - len(kept)
+  s.outbox = kept
+
+  return purged, nil
+}
+
+func (s *MemoryStore) revisionIndex(id, revision int) int {
+  for i, r := range s.revisions[id] {
+    if r.Revision == revision {
+      return i
+    }
+  }
+
+  return -1
+}
+
+func (s *MemoryStore) PurgeResources(before time.Time) (int, error) {
+  s.mutex.Lock()
+  defer s.mutex.Unlock()
+
+  purged := 0
+
+  for id, stored := range s.resources {
+    if stored.DeletedAt != nil && stored.DeletedAt.Before(before) {
+      delete(s.resources, id)
+      delete(s.revisions, id)
+      purged++
+    }
+  }
+
+  return purged, nil
+}
+
+// live returns a resource which is not in the trash
+func (s *MemoryStore) live(id int) (Resource, bool) {
+  stored, found := s.resources[id]
+
+  return stored, found && stored.DeletedAt == nil
+}
+
+func (s *MemoryStore) CreateResource(ctx context.Context, r *Resource) error {
+  c := changeOf(ctx)
+
+  s.mutex.Lock()
+  defer s.mutex.Unlock()
+
+  s.lastID++
+  r.ID = s.lastID
+  r.Version = 1
+  r.Needs = normalizeNeeds(r.Needs)
+  r.CreatedAt = now()
+  r.UpdatedAt = r.CreatedAt
+  r.UpdatedBy = c.actor
+  r.CreatedBy = c.actor
+  r.DeletedAt = nil
+  s.resources[r.ID] = *r
+  s.record(*r, RevisionCreated, c.correlationID)
+
+  return nil
+}
+
+func (s *MemoryStore) GetResources(start, count int) ([]Resource, error) {
+  s.mutex.RLock()
+  defer s.mutex.RUnlock()
+
+  ids := s.sortedIDs(false)
+  resources := []Resource{}
+
+  for i := start; i < len(ids) && len(resources) < count; i++ {
+    resources = append(resources, s.resources[ids[i]])
+  }
+
+  return resources, nil
+}
+
+func (s *MemoryStore) ListResources(q Query) (Page, error) {
+  s.mutex.RLock()
+  defer s.mutex.RUnlock()
+
+  order := q.Sort.orDefault()
+  matching := []Resource{}
+
+  for _, id := range s.sortedIDs(q.Deleted) {
+    stored := s.resources[id]
+
+    if q.Filter.match(stored) && (q.Need == 0 || stored.HasNeed(q.Need)) {
+      matching = append(matching, stored)
+    }
+  }
+
+  sort.SliceStable(matching, func(i, j int) bool {
+    return order.compareKeys(order.key(matching[i]), order.key(matching[j])) < 0
+  })
+
+  resources := []Resource{}
+
+  if q.Cursor != nil && q.Cursor.Backward {
+    for i := len(matching) - 1; i >= 0 && len(resources) <= q.Limit; i-- {
+      if !q.Cursor.before() || order.compareKeys(order.key(matching[i]), q.Cursor.Key) < 0 {
+        resources = append(resources, matching[i])
+      }
+    }
+  } else {
+    for i := 0; i < len(matching) && len(resources) <= q.Limit; i++ {
+      if !q.Cursor.after() || order.compareKeys(order.key(matching[i]), q.Cursor.Key) > 0 {
+        resources = append(resources, matching[i])
+      }
+    }
+  }
+
+  page := newPage(q, resources)
+
+  if q.IncludeTotal {
+    total := len(matching)
+    page.Total = &total
+  }
+
+  return page, nil
+}
+
+func (s *MemoryStore) SearchResources(query string, limit int) ([]SearchResult, error) {
+  s.mutex.RLock()
+  defer s.mutex.RUnlock()
+
+  terms := searchTerms(query)
+  if len(terms) == 0 {
+    return nil, ErrEmptySearch
+  }
+
+  results := []SearchResult{}
+
+  for _, id := range s.sortedIDs(false) {
+    if result, found := matchSearch(s.resources[id], terms); found {
+      results = append(results, result)
+    }
+  }
+
+  sort.SliceStable(results, func(i, j int) bool {
+    return results[i].Rank > results[j].Rank
+  })
+
+  if len(results) > limit {
+    results = results[:limit]
+  }
+
+  return results, nil
+}
+
+// sortedIDs returns the ids of the resources in the trash, or of the live
+// ones
+func (s *MemoryStore) sortedIDs(deleted bool) []int {
+  ids := make([]int, 0, len(s.resources))
+  for id, r := range s.resources {
+    if (r.DeletedAt != nil) == deleted {
+      ids = append(ids, id)
+    }
+  }
+  sort.Ints(ids)
+
+  return ids
+}
+
+func (s *MemoryStore) CountResources() (int, error) {
+  s.mutex.RLock()
+  defer s.mutex.RUnlock()
+
+  return len(s.sortedIDs(false)), nil
+}
@@ -0,0 +1,84 @@
+package resource
+
+import (
+  sort "sort"
+)
+
+// normalizeNeeds returns a sorted copy of need IDs, never nil
+func normalizeNeeds(ids []int) []int {
+  needs := make([]int, len(ids))
+  copy(needs, ids)
+  sort.Ints(needs)
+
+  return needs
+}
+
+// HasNeed tells whether the resource answers a need
+func (r *Resource) HasNeed(id int) bool {
+  for _, n := range r.Needs {
+    if n == id {
+      return true
+    }
+  }
+
+  return false
+}
+
+// AttachNeed links the resource to a need, unless it already is, and tells
+// whether it changed
+func (r *Resource) AttachNeed(id int) bool {
+  if r.HasNeed(id) {
+    return false
+  }
+
+  r.Needs = normalizeNeeds(append(append([]int{}, r.Needs...), id))
+
+  return true
+}
+
+// DetachNeed unlinks the resource from a need, if it is linked, and tells
+// whether it changed
+func (r *Resource) DetachNeed(id int) bool {
+  if !r.HasNeed(id) {
+    return false
+  }
+
+  needs := []int{}
+
+  for _, n := range r.Needs {
+    if n != id {
+      needs = append(needs, n)
+    }
+  }
+
+  r.Needs = needs
+
+  return true
+}
+
+// AddedNeeds returns the needs of after which before has not
+func AddedNeeds(before, after Resource) []int {
+  var added []int
+
+  for _, id := range after.Needs {
+    if !before.HasNeed(id) {
+      added = append(added, id)
+    }
+  }
+
+  return added
+}
+
+func sameNeeds(a, b []int) bool {
+  if len(a) != len(b) {
+    return false
+  }
+
+  for i := range a {
+    if a[i] != b[i] {
+      return false
+    }
+  }
+
+  return true
+}
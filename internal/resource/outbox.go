@@ -0,0 +1,29 @@
+package resource
+
+import (
+  event "github.com/gpenaud/needys-api-resource/internal/event"
+)
+
+// announce builds the event announcing the change of a resource which
+// produced a revision; restorations, reverts and needs changes are updates
+func announce(r Resource, operation, correlationID string) (event.Event, error) {
+  kind := event.ResourceUpdated
+
+  switch operation {
+  case RevisionCreated:
+    kind = event.ResourceCreated
+  case RevisionDeleted:
+    kind = event.ResourceDeleted
+  }
+
+  e, err := event.New(kind, r)
+  if err != nil {
+    return e, err
+  }
+
+  e.Time = r.UpdatedAt
+  e.Actor = r.UpdatedBy
+  e.CorrelationID = correlationID
+
+  return e, nil
+}
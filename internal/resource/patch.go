@@ -0,0 +1,480 @@
+package resource
+
+import (
+  errors  "errors"
+  fmt     "fmt"
+  io      "io"
+  json    "encoding/json"
+  reflect "reflect"
+  strconv "strconv"
+  strings "strings"
+)
+
+const (
+  MergePatchContentType = "application/merge-patch+json"
+  JSONPatchContentType  = "application/json-patch+json"
+)
+
+var (
+  // ErrUnsupportedPatch is returned for a patch of an unknown content type
+  ErrUnsupportedPatch = errors.New("unsupported patch content type")
+  // ErrMalformedPatch is returned when a patch document is not valid JSON
+  ErrMalformedPatch = errors.New("malformed patch document")
+  // ErrPatchTestFailed is returned when a JSON Patch test operation fails
+  ErrPatchTestFailed = errors.New("a test operation of the patch failed")
+)
+
+// PatchError is a patch document which cannot be applied to a resource
+type PatchError struct {
+  Message string
+}
+
+func (e *PatchError) Error() string {
+  return e.Message
+}
+
+// Patch is a parsed patch document, applied to the JSON representation of a
+// resource
+type Patch interface {
+  apply(document interface{}) (interface{}, error)
+}
+
+// ParsePatch reads a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902)
+// according to its media type
+func ParsePatch(mediaType string, reader io.Reader) (Patch, error) {
+  switch mediaType {
+  case MergePatchContentType:
+    var document interface{}
+
+    if err := json.NewDecoder(reader).Decode(&document); err != nil {
+      return nil, ErrMalformedPatch
+    }
+
+    return mergePatch{document}, nil
+  case JSONPatchContentType:
+    var operations jsonPatch
+
+    if err := json.NewDecoder(reader).Decode(&operations); err != nil {
+      return nil, ErrMalformedPatch
+    }
+
+    if err := operations.check(); err != nil {
+      return nil, err
+    }
+
+    return operations, nil
+  default:
+    return nil, ErrUnsupportedPatch
+  }
+}
+
+// Apply patches the resource, then decodes and validates the result as a
+// payload would be; the resource is left untouched on error
+func (r *Resource) Apply(p Patch) error {
+  original, err := json.Marshal(r)
+  if err != nil {
+    return err
+  }
+
+  var document interface{}
+
+  if err = json.Unmarshal(original, &document); err != nil {
+    return err
+  }
+
+  if document, err = p.apply(document); err != nil {
+    return err
+  }
+
+  if _, isObject := document.(map[string]interface{}); !isObject {
+    return &PatchError{"the patched resource must be a JSON object"}
+  }
+
+  patched, err := json.Marshal(document)
+  if err != nil {
+    return err
+  }
+
+  result, _, problems, err := decode(patched)
+  if err != nil {
+    return err
+  }
+
+  // a field which could not be decoded is not reported as changed as well
+  decoded := len(problems)
+
+  for _, change := range readOnlyChanges(*r, result) {
+    if !reportedField(problems[:decoded], change.Field) {
+      problems = append(problems, change)
+    }
+  }
+
+  if err = validateDecoded(result, problems); err != nil {
+    return err
+  }
+
+  *r = result
+
+  return nil
+}
+
+// readOnlyChanges reports the fields managed by the store which a patch
+// changed
+func readOnlyChanges(original, patched Resource) []FieldError {
+  var problems []FieldError
+
+  check := func(name string, changed bool) {
+    if changed {
+      problems = append(problems, FieldError{name, "is read-only"})
+    }
+  }
+
+  check("id", patched.ID != original.ID)
+  check("version", patched.Version != original.Version)
+  check("created_at", !patched.CreatedAt.Equal(original.CreatedAt))
+  check("updated_at", !patched.UpdatedAt.Equal(original.UpdatedAt))
+  check("created_by", patched.CreatedBy != original.CreatedBy)
+  check("updated_by", patched.UpdatedBy != original.UpdatedBy)
+  check("deleted_at", patched.DeletedAt != nil)
+
+  return problems
+}
+
+// -------------------------------------------------------------------------- //
+// JSON Merge Patch
+
+type mergePatch struct {
+  document interface{}
+}
+
+func (p mergePatch) apply(document interface{}) (interface{}, error) {
+  return merge(document, p.document), nil
+}
+
+func merge(target, patch interface{}) interface{} {
+  patchObject, isObject := patch.(map[string]interface{})
+  if !isObject {
+    return patch
+  }
+
+  targetObject, isObject := target.(map[string]interface{})
+  if !isObject {
+    targetObject = map[string]interface{}{}
+  }
+
+  for name, value := range patchObject {
+    if value == nil {
+      delete(targetObject, name)
+    } else {
+      targetObject[name] = merge(targetObject[name], value)
+    }
+  }
+
+  return targetObject
+}
+
+// -------------------------------------------------------------------------- //
+// JSON Patch
+
+type operation struct {
+  Op    string          `json:"op"`
+  Path  *string         `json:"path"`
+  From  *string         `json:"from"`
+  Value json.RawMessage `json:"value"`
+}
+
+type jsonPatch []operation
+
+// check rejects operations missing a member their kind requires, before any
+// of them is applied
+func (p jsonPatch) check() error {
+  for i, o := range p {
+    fail := func(message string) error {
+      return &PatchError{fmt.Sprintf("operation %d: %s", i, message)}
+    }
+
+    switch o.Op {
+    case "add", "remove", "replace", "move", "copy", "test":
+    default:
+      return fail(fmt.Sprintf("unknown op %q", o.Op))
+    }
+
+    if o.Path == nil {
+      return fail("the path is missing")
+    }
+
+    if _, err := pointer(*o.Path); err != nil {
+      return fail(err.Error())
+    }
+
+    switch o.Op {
+    case "add", "replace", "test":
+      if o.Value == nil {
+        return fail("the value is missing")
+      }
+    case "move", "copy":
+      if o.From == nil {
+        return fail("the from location is missing")
+      }
+
+      if _, err := pointer(*o.From); err != nil {
+        return fail(err.Error())
+      }
+    }
+
+    if o.Op == "move" && strings.HasPrefix(*o.Path, *o.From + "/") {
+      return fail("a value cannot be moved into one of its children")
+    }
+  }
+
+  return nil
+}
+
+func (p jsonPatch) apply(document interface{}) (interface{}, error) {
+  var err error
+
+  for i, o := range p {
+    if document, err = o.apply(document); err != nil {
+      if err == ErrPatchTestFailed {
+        return nil, err
+      }
+
+      return nil, &PatchError{fmt.Sprintf("operation %d: %s", i, err)}
+    }
+  }
+
+  return document, nil
+}
+
+func (o operation) apply(document interface{}) (interface{}, error) {
+  path, _ := pointer(*o.Path)
+
+  var value interface{}
+
+  if o.Value != nil {
+    if err := json.Unmarshal(o.Value, &value); err != nil {
+      return nil, err
+    }
+  }
+
+  switch o.Op {
+  case "add":
+    return add(document, path, value)
+  case "remove":
+    return remove(document, path)
+  case "replace":
+    if len(path) == 0 {
+      return value, nil
+    }
+
+    document, err := remove(document, path)
+    if err != nil {
+      return nil, err
+    }
+
+    return add(document, path, value)
+  case "move", "copy":
+    from, _ := pointer(*o.From)
+
+    value, err := get(document, from)
+    if err != nil {
+      return nil, err
+    }
+
+    if o.Op == "move" {
+      if document, err = remove(document, from); err != nil {
+        return nil, err
+      }
+    } else {
+      value = deepCopy(value)
+    }
+
+    return add(document, path, value)
+  default:
+    current, err := get(document, path)
+    if err != nil {
+      return nil, err
+    }
+
+    if !reflect.DeepEqual(current, value) {
+      return nil, ErrPatchTestFailed
+    }
+
+    return document, nil
+  }
+}
+
+// pointer splits a JSON Pointer (RFC 6901) in unescaped reference tokens
+func pointer(path string) ([]string, error) {
+  if path == "" {
+    return nil, nil
+  }
+
+  if !strings.HasPrefix(path, "/") {
+    return nil, fmt.Errorf("the path %q is not a JSON pointer", path)
+  }
+
+  tokens := strings.Split(path[1:], "/")
+
+  for i, token := range tokens {
+    tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+  }
+
+  return tokens, nil
+}
+
+func index(token string, length int) (int, error) {
+  i, err := strconv.Atoi(token)
+
+  if err != nil || i < 0 || i >= length || (len(token) > 1 && token[0] == '0') {
+    return 0, fmt.Errorf("the array index %q is out of range", token)
+  }
+
+  return i, nil
+}
+
+func get(document interface{}, tokens []string) (interface{}, error) {
+  for _, token := range tokens {
+    switch node := document.(type) {
+    case map[string]interface{}:
+      value, found := node[token]
+      if !found {
+        return nil, fmt.Errorf("the member %q does not exist", token)
+      }
+
+      document = value
+    case []interface{}:
+      i, err := index(token, len(node))
+      if err != nil {
+        return nil, err
+      }
+
+      document = node[i]
+    default:
+      return nil, fmt.Errorf("the location %q does not exist", token)
+    }
+  }
+
+  return document, nil
+}
+
+// at walks to the parent of the location tokens point to, and replaces it by
+// what change returns
+func at(document interface{}, tokens []string,
+  change func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+  if len(tokens) == 1 {
+    return change(document, tokens[0])
+  }
+
+  switch node := document.(type) {
+  case map[string]interface{}:
+    child, found := node[tokens[0]]
+    if !found {
+      return nil, fmt.Errorf("the member %q does not exist", tokens[0])
+    }
+
+    child, err := at(child, tokens[1:], change)
+    if err != nil {
+      return nil, err
+    }
+
+    node[tokens[0]] = child
+
+    return node, nil
+  case []interface{}:
+    i, err := index(tokens[0], len(node))
+    if err != nil {
+      return nil, err
+    }
+
+    if node[i], err = at(node[i], tokens[1:], change); err != nil {
+      return nil, err
+    }
+
+    return node, nil
+  default:
+    return nil, fmt.Errorf("the location %q does not exist", tokens[0])
+  }
+}
+
+func add(document interface{}, tokens []string, value interface{}) (interface{}, error) {
+  if len(tokens) == 0 {
+    return value, nil
+  }
+
+  return at(document, tokens, func(parent interface{}, token string) (interface{}, error) {
+    switch node := parent.(type) {
+    case map[string]interface{}:
+      node[token] = value
+      return node, nil
+    case []interface{}:
+      if token == "-" {
+        return append(node, value), nil
+      }
+
+      // an element may be added right after the last one
+      i, err := index(token, len(node) + 1)
+      if err != nil {
+        return nil, err
+      }
+
+      node = append(node, nil)
+      copy(node[i+1:], node[i:])
+      node[i] = value
+
+      return node, nil
+    default:
+      return nil, fmt.Errorf("the location %q cannot hold members", token)
+    }
+  })
+}
+
+func remove(document interface{}, tokens []string) (interface{}, error) {
+  if len(tokens) == 0 {
+    return nil, errors.New("the whole resource cannot be removed")
+  }
+
+  return at(document, tokens, func(parent interface{}, token string) (interface{}, error) {
+    switch node := parent.(type) {
+    case map[string]interface{}:
+      if _, found := node[token]; !found {
+        return nil, fmt.Errorf("the member %q does not exist", token)
+      }
+
+      delete(node, token)
+      return node, nil
+    case []interface{}:
+      i, err := index(token, len(node))
+      if err != nil {
+        return nil, err
+      }
+
+      return append(node[:i], node[i+1:]...), nil
+    default:
+      return nil, fmt.Errorf("the location %q does not exist", token)
+    }
+  })
+}
+
+func deepCopy(value interface{}) interface{} {
+  switch v := value.(type) {
+  case map[string]interface{}:
+    c := make(map[string]interface{}, len(v))
+
+    for name, member := range v {
+      c[name] = deepCopy(member)
+    }
+
+    return c
+  case []interface{}:
+    c := make([]interface{}, len(v))
+
+    for i, element := range v {
+      c[i] = deepCopy(element)
+    }
+
+    return c
+  default:
+    return value
+  }
+}
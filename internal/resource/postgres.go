@@ -0,0 +1,855 @@
+package resource
+
+import (
+  context   "context"
+  event     "github.com/gpenaud/needys-api-resource/internal/event"
+  fmt       "fmt"
+  json      "encoding/json"
+  pq        "github.com/lib/pq"
+  log       "github.com/sirupsen/logrus"
+  migration "github.com/gpenaud/needys-api-resource/internal/migration"
+  sql       "database/sql"
+  strings   "strings"
+  time      "time"
+)
+
+var postgresLog *log.Entry
+
+func init() {
+  postgresLog = log.WithFields(log.Fields{
+    "_file": "internal/resource/postgres.go",
+    "_type": "user",
+  })
+}
+
+type PostgresStore struct {
+  DB *sql.DB
+  // announced is set by EnableOutbox
+  announced bool
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+  return &PostgresStore{DB: db}
+}
+
+const dbResetQuery = `
+  DELETE FROM resources;
+  ALTER SEQUENCE resources_id_seq RESTART WITH 1;
+  `
+
+func (s *PostgresStore) Initialize() error {
+  if err := migration.New(s.DB).Up(0); err != nil {
+    return err
+  }
+
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+  }).Debug("DELETE FROM resources, then reseed it")
+
+  if _, err := s.DB.Exec(dbResetQuery); err != nil {
+    return err
+  }
+
+  for i := range Seeds {
+    seed := Seeds[i]
+
+    if err := s.CreateResource(context.Background(), &seed); err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
+
+func (s *PostgresStore) Ping(ctx context.Context) error {
+  return s.DB.PingContext(ctx)
+}
+
+// resourceColumns are selected in the order of Resource.columns
+const resourceColumns =
+  "id, type, description, version, created_at, updated_at, created_by, updated_by, deleted_at, " +
+  "ARRAY(SELECT need_id FROM resource_needs WHERE resource_id = resources.id ORDER BY need_id)"
+
+// columns are the scan destinations of resourceColumns
+func (r *Resource) columns() []interface{} {
+  return []interface{}{
+    &r.ID, &r.Type, &r.Description, &r.Version,
+    &r.CreatedAt, &r.UpdatedAt, &r.CreatedBy, &r.UpdatedBy, &r.DeletedAt, needsScanner{&r.Needs},
+  }
+}
+
+// needsScanner scans an array of need IDs
+type needsScanner struct {
+  needs *[]int
+}
+
+func (s needsScanner) Scan(src interface{}) error {
+  var ids pq.Int64Array
+
+  if err := ids.Scan(src); err != nil {
+    return err
+  }
+
+  *s.needs = make([]int, len(ids))
+
+  for i, id := range ids {
+    (*s.needs)[i] = int(id)
+  }
+
+  return nil
+}
+
+// replaceNeeds links a resource to needs only, in the transaction of its
+// change, and sets them on it
+func replaceNeeds(tx *sql.Tx, r *Resource, needs []int) error {
+  if _, err := tx.Exec("DELETE FROM resource_needs WHERE resource_id=$1", r.ID); err != nil {
+    return err
+  }
+
+  for _, need := range needs {
+    if _, err := tx.Exec("INSERT INTO resource_needs(resource_id, need_id) VALUES($1, $2)", r.ID, need); err != nil {
+      return err
+    }
+  }
+
+  r.Needs = normalizeNeeds(needs)
+
+  return nil
+}
+
+func (s *PostgresStore) GetResource(r *Resource) error {
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_id": r.ID,
+  }).Debug("SELECT id, type, ... FROM resources WHERE id={id} AND deleted_at IS NULL")
+
+  err := s.DB.QueryRow("SELECT " + resourceColumns + " FROM resources WHERE id=$1 AND deleted_at IS NULL",
+    r.ID).Scan(r.columns()...)
+
+  if err == sql.ErrNoRows {
+    return ErrNotFound
+  }
+
+  return err
+}
+
+func (s *PostgresStore) GetTrashedResource(r *Resource) error {
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_id": r.ID,
+  }).Debug("SELECT id, type, ... FROM resources WHERE id={id} AND deleted_at IS NOT NULL")
+
+  err := s.DB.QueryRow("SELECT " + resourceColumns + " FROM resources WHERE id=$1 AND deleted_at IS NOT NULL",
+    r.ID).Scan(r.columns()...)
+
+  if err == sql.ErrNoRows {
+    return ErrNotFound
+  }
+
+  return err
+}
+
+func (s *PostgresStore) UpdateResource(ctx context.Context, r *Resource) error {
+  c := changeOf(ctx)
+
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_type": r.Type,
+    "parameter_description": r.Description,
+    "parameter_id": r.ID,
+    "parameter_version": r.Version,
+    "parameter_actor": c.actor,
+  }).Debug("UPDATE resources SET type={type}, description={description}, version=version+1, ... WHERE id={id} AND version={version}")
+
+  needs := r.Needs
+
+  err := s.transaction(func(tx *sql.Tx) error {
+    err := tx.QueryRow(
+      "UPDATE resources SET type=$1, description=$2, version=version+1, updated_at=now(), updated_by=$5 " +
+      "WHERE id=$3 AND ($4 = 0 OR version=$4) AND deleted_at IS NULL RETURNING " + resourceColumns,
+      r.Type, r.Description, r.ID, r.Version, c.actor).Scan(r.columns()...)
+
+    if err != nil {
+      return err
+    }
+
+    if err = replaceNeeds(tx, r, needs); err != nil {
+      return err
+    }
+
+    return s.record(tx, r, RevisionUpdated, c.correlationID)
+  })
+
+  if err == sql.ErrNoRows {
+    return s.unchanged(r.ID, false)
+  }
+
+  return err
+}
+
+func (s *PostgresStore) PatchResource(ctx context.Context, r *Resource, apply func(*Resource) error) error {
+  c := changeOf(ctx)
+
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_id": r.ID,
+    "parameter_version": r.Version,
+    "parameter_actor": c.actor,
+  }).Debug("SELECT id, type, ... FROM resources WHERE id={id} FOR UPDATE, then UPDATE it")
+
+  expected := r.Version
+
+  return s.transaction(func(tx *sql.Tx) error {
+    err := tx.QueryRow(
+      "SELECT " + resourceColumns + " FROM resources WHERE id=$1 AND deleted_at IS NULL FOR UPDATE",
+      r.ID).Scan(r.columns()...)
+
+    if err == sql.ErrNoRows {
+      return ErrNotFound
+    }
+
+    if err != nil {
+      return err
+    }
+
+    if expected != 0 && expected != r.Version {
+      return ErrVersionMismatch
+    }
+
+    loaded := *r
+
+    if err = apply(r); err == ErrNoChange {
+      *r = loaded
+      return nil
+    } else if err != nil {
+      return err
+    }
+
+    needs := r.Needs
+
+    err = tx.QueryRow(
+      "UPDATE resources SET type=$1, description=$2, version=version+1, updated_at=now(), updated_by=$4 " +
+      "WHERE id=$3 RETURNING " + resourceColumns,
+      r.Type, r.Description, r.ID, c.actor).Scan(r.columns()...)
+
+    if err != nil {
+      return err
+    }
+
+    if err = replaceNeeds(tx, r, needs); err != nil {
+      return err
+    }
+
+    return s.record(tx, r, RevisionUpdated, c.correlationID)
+  })
+}
+
+func (s *PostgresStore) DeleteResource(ctx context.Context, r *Resource) error {
+  c := changeOf(ctx)
+
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_id": r.ID,
+    "parameter_version": r.Version,
+    "parameter_actor": c.actor,
+  }).Debug("UPDATE resources SET deleted_at=now(), ... WHERE id={id} AND version={version} AND deleted_at IS NULL")
+
+  err := s.transaction(func(tx *sql.Tx) error {
+    err := tx.QueryRow(
+      "UPDATE resources SET deleted_at=now(), version=version+1, updated_at=now(), updated_by=$3 " +
+      "WHERE id=$1 AND ($2 = 0 OR version=$2) AND deleted_at IS NULL RETURNING " + resourceColumns,
+      r.ID, r.Version, c.actor).Scan(r.columns()...)
+
+    if err != nil {
+      return err
+    }
+
+    return s.record(tx, r, RevisionDeleted, c.correlationID)
+  })
+
+  if err == sql.ErrNoRows {
+    return s.unchanged(r.ID, false)
+  }
+
+  return err
+}
+
+func (s *PostgresStore) RestoreResource(ctx context.Context, r *Resource) error {
+  c := changeOf(ctx)
+
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_id": r.ID,
+    "parameter_version": r.Version,
+    "parameter_actor": c.actor,
+  }).Debug("UPDATE resources SET deleted_at=NULL, ... WHERE id={id} AND version={version} AND deleted_at IS NOT NULL")
+
+  err := s.transaction(func(tx *sql.Tx) error {
+    err := tx.QueryRow(
+      "UPDATE resources SET deleted_at=NULL, version=version+1, updated_at=now(), updated_by=$3 " +
+      "WHERE id=$1 AND ($2 = 0 OR version=$2) AND deleted_at IS NOT NULL RETURNING " + resourceColumns,
+      r.ID, r.Version, c.actor).Scan(r.columns()...)
+
+    if err != nil {
+      return err
+    }
+
+    return s.record(tx, r, RevisionRestored, c.correlationID)
+  })
+
+  if err == sql.ErrNoRows {
+    return s.unchanged(r.ID, true)
+  }
+
+  return err
+}
+
+func (s *PostgresStore) RevertResource(ctx context.Context, r *Resource, revision int) error {
+  c := changeOf(ctx)
+
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_id": r.ID,
+    "parameter_version": r.Version,
+    "parameter_revision": revision,
+    "parameter_actor": c.actor,
+  }).Debug("UPDATE resources SET type, description, needs FROM resource_revisions WHERE id={id} AND revision={revision}")
+
+  return s.transaction(func(tx *sql.Tx) error {
+    var version int
+
+    err := tx.QueryRow("SELECT version FROM resources WHERE id=$1 AND deleted_at IS NULL FOR UPDATE",
+      r.ID).Scan(&version)
+
+    if err == sql.ErrNoRows {
+      return ErrNotFound
+    }
+
+    if err != nil {
+      return err
+    }
+
+    if r.Version != 0 && r.Version != version {
+      return ErrVersionMismatch
+    }
+
+    var data []byte
+
+    err = tx.QueryRow("SELECT data FROM resource_revisions WHERE resource_id=$1 AND revision=$2",
+      r.ID, revision).Scan(&data)
+
+    if err == sql.ErrNoRows {
+      return ErrRevisionNotFound
+    }
+
+    if err != nil {
+      return err
+    }
+
+    var target Resource
+
+    if err = json.Unmarshal(data, &target); err != nil {
+      return err
+    }
+
+    err = tx.QueryRow(
+      "UPDATE resources SET type=$1, description=$2, version=version+1, updated_at=now(), updated_by=$4 " +
+      "WHERE id=$3 RETURNING " + resourceColumns,
+      target.Type, target.Description, r.ID, c.actor).Scan(r.columns()...)
+
+    if err != nil {
+      return err
+    }
+
+    if err = replaceNeeds(tx, r, target.Needs); err != nil {
+      return err
+    }
+
+    return s.record(tx, r, RevisionReverted, c.correlationID)
+  })
+}
+
+const revisionColumns = "resource_id, revision, operation, actor, created_at, data"
+
+func (s *PostgresStore) ListRevisions(id int) ([]Revision, error) {
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_id": id,
+  }).Debug("SELECT ... FROM resource_revisions WHERE resource_id={id} ORDER BY revision")
+
+  rows, err := s.DB.Query(
+    "SELECT " + revisionColumns + " FROM resource_revisions WHERE resource_id=$1 ORDER BY revision", id)
+
+  if err != nil {
+    return nil, err
+  }
+
+  revisions, err := scanRevisions(rows)
+  if err != nil {
+    return nil, err
+  }
+
+  if len(revisions) == 0 {
+    return nil, ErrNotFound
+  }
+
+  chain(Resource{}, revisions)
+
+  return reverse(revisions), nil
+}
+
+func (s *PostgresStore) GetRevision(id, revision int) (Revision, error) {
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_id": id,
+    "parameter_revision": revision,
+  }).Debug("SELECT ... FROM resource_revisions WHERE resource_id={id} AND revision <= {revision} ORDER BY revision DESC LIMIT 2")
+
+  // the previous revision comes along, to compute the changes
+  rows, err := s.DB.Query(
+    "SELECT " + revisionColumns + " FROM resource_revisions " +
+    "WHERE resource_id=$1 AND revision <= $2 ORDER BY revision DESC LIMIT 2", id, revision)
+
+  if err != nil {
+    return Revision{}, err
+  }
+
+  revisions, err := scanRevisions(rows)
+  if err != nil {
+    return Revision{}, err
+  }
+
+  if len(revisions) == 0 || revisions[0].Revision != revision {
+    var exists bool
+
+    err := s.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM resource_revisions WHERE resource_id=$1)",
+      id).Scan(&exists)
+
+    switch {
+    case err != nil:
+      return Revision{}, err
+    case exists:
+      return Revision{}, ErrRevisionNotFound
+    default:
+      return Revision{}, ErrNotFound
+    }
+  }
+
+  revisions = reverse(revisions)
+
+  previous := Resource{}
+  if len(revisions) == 2 {
+    previous = revisions[0].Resource
+  }
+
+  current := revisions[len(revisions) - 1:]
+  chain(previous, current)
+
+  return current[0], nil
+}
+
+func scanRevisions(rows *sql.Rows) ([]Revision, error) {
+  defer rows.Close()
+
+  revisions := []Revision{}
+
+  for rows.Next() {
+    var r Revision
+    var data []byte
+
+    if err := rows.Scan(&r.ResourceID, &r.Revision, &r.Operation, &r.Actor, &r.CreatedAt, &data); err != nil {
+      return nil, err
+    }
+
+    if err := json.Unmarshal(data, &r.Resource); err != nil {
+      return nil, err
+    }
+
+    revisions = append(revisions, r)
+  }
+
+  return revisions, rows.Err()
+}
+
+// transaction runs change in a transaction, which is committed unless change
+// fails
+func (s *PostgresStore) transaction(change func(tx *sql.Tx) error) error {
+  tx, err := s.DB.Begin()
+  if err != nil {
+    return err
+  }
+
+  if err = change(tx); err != nil {
+    tx.Rollback()
+    return err
+  }
+
+  return tx.Commit()
+}
+
+// record inserts the revision a change of r produced, and the event
+// announcing it in the outbox when it is enabled, in the transaction of the
+// change
+func (s *PostgresStore) record(tx *sql.Tx, r *Resource, operation, correlationID string) error {
+  revision := newRevision(*r, operation)
+
+  data, err := json.Marshal(revision.Resource)
+  if err != nil {
+    return err
+  }
+
+  _, err = tx.Exec("INSERT INTO resource_revisions(" + revisionColumns + ") VALUES($1, $2, $3, $4, $5, $6)",
+    revision.ResourceID, revision.Revision, revision.Operation, revision.Actor, revision.CreatedAt, data)
+
+  if err != nil || !s.announced {
+    return err
+  }
+
+  e, err := announce(*r, operation, correlationID)
+  if err != nil {
+    return err
+  }
+
+  if data, err = json.Marshal(e); err != nil {
+    return err
+  }
+
+  _, err = tx.Exec("INSERT INTO outbox(event) VALUES($1)", data)
+
+  return err
+}
+
+func (s *PostgresStore) EnableOutbox() {
+  s.announced = true
+}
+
+func (s *PostgresStore) RelayEvents(limit int, deliver func(event.Event) error) (int, error) {
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_limit": limit,
+  }).Debug("SELECT id, event FROM outbox WHERE published_at IS NULL ORDER BY id LIMIT {limit} FOR UPDATE")
+
+  delivered := 0
+  var failure error
+
+  // the rows stay locked while they are delivered, so the relays of several
+  // instances deliver them one after the other, in order
+  err := s.transaction(func(tx *sql.Tx) error {
+    rows, err := tx.Query(
+      "SELECT id, event FROM outbox WHERE published_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE", limit)
+
+    if err != nil {
+      return err
+    }
+
+    var ids []int64
+    var events []event.Event
+
+    for rows.Next() {
+      var id int64
+      var data []byte
+      var e event.Event
+
+      if err = rows.Scan(&id, &data); err != nil {
+        rows.Close()
+        return err
+      }
+
+      if err = json.Unmarshal(data, &e); err != nil {
+        rows.Close()
+        return err
+      }
+
+      ids = append(ids, id)
+      events = append(events, e)
+    }
+
+    if err = rows.Err(); err != nil {
+      return err
+    }
+
+    for i, e := range events {
+      if failure = deliver(e); failure != nil {
+        // the failure is recorded and the delivered events marked, all the
+        // same
+        _, err = tx.Exec("UPDATE outbox SET attempts=attempts+1, last_error=$2 WHERE id=$1",
+          ids[i], failure.Error())
+
+        return err
+      }
+
+      _, err = tx.Exec("UPDATE outbox SET attempts=attempts+1, published_at=now() WHERE id=$1", ids[i])
+      if err != nil {
+        return err
+      }
+
+      delivered++
+    }
+
+    return nil
+  })
+
+  if err != nil {
+    return 0, err
+  }
+
+  return delivered, failure
+}
+
+func (s *PostgresStore) PurgeEvents(before time.Time) (int, error) {
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_before": before,
+  }).Debug("DELETE FROM outbox WHERE published_at < {before}")
+
+  result, err := s.DB.Exec("DELETE FROM outbox WHERE published_at < $1", before)
+  if err != nil {
+    return 0, err
+  }
+
+  purged, err := result.RowsAffected()
+
+  return int(purged), err
+}
+
+func (s *PostgresStore) PurgeResources(before time.Time) (int, error) {
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_before": before,
+  }).Debug("DELETE FROM resources WHERE deleted_at < {before}")
+
+  result, err := s.DB.Exec("DELETE FROM resources WHERE deleted_at < $1", before)
+  if err != nil {
+    return 0, err
+  }
+
+  purged, err := result.RowsAffected()
+
+  return int(purged), err
+}
+
+// unchanged tells why a conditional statement on a live resource, or on one
+// in the trash, matched no row
+func (s *PostgresStore) unchanged(id int, deleted bool) error {
+  var version int
+
+  err := s.DB.QueryRow("SELECT version FROM resources WHERE id=$1 AND " + liveness(deleted),
+    id).Scan(&version)
+
+  switch err {
+  case sql.ErrNoRows:
+    return ErrNotFound
+  case nil:
+    return ErrVersionMismatch
+  default:
+    return err
+  }
+}
+
+// liveness is the condition selecting the resources in the trash, or the live
+// ones
+func liveness(deleted bool) string {
+  if deleted {
+    return "deleted_at IS NOT NULL"
+  }
+
+  return "deleted_at IS NULL"
+}
+
+func (s *PostgresStore) CreateResource(ctx context.Context, r *Resource) error {
+  c := changeOf(ctx)
+
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_type": r.Type,
+    "parameter_description": r.Description,
+    "parameter_actor": c.actor,
+  }).Debug("INSERT INTO resources(type, description, created_by, updated_by) VALUES({type}, {description}, {actor}, {actor}) RETURNING ...")
+
+  needs := r.Needs
+
+  return s.transaction(func(tx *sql.Tx) error {
+    err := tx.QueryRow(
+      "INSERT INTO resources(type, description, created_by, updated_by) VALUES($1, $2, $3, $3) RETURNING " +
+      resourceColumns, r.Type, r.Description, c.actor).Scan(r.columns()...)
+
+    if err != nil {
+      return err
+    }
+
+    if err = replaceNeeds(tx, r, needs); err != nil {
+      return err
+    }
+
+    return s.record(tx, r, RevisionCreated, c.correlationID)
+  })
+}
+
+func (s *PostgresStore) GetResources(start, count int) ([]Resource, error) {
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_count": count,
+    "parameter_start": start,
+  }).Debug("SELECT id, type, ... FROM resources WHERE deleted_at IS NULL ORDER BY id LIMIT {count} OFFSET {start}")
+
+  rows, err := s.DB.Query(
+    "SELECT " + resourceColumns + " FROM resources WHERE deleted_at IS NULL ORDER BY id LIMIT $1 OFFSET $2",
+    count, start)
+
+  if err != nil {
+    return nil, err
+  }
+
+  return scanResources(rows)
+}
+
+func (s *PostgresStore) ListResources(q Query) (Page, error) {
+  filter, filterArgs := q.Filter.sql(nil)
+
+  if q.Need != 0 {
+    filterArgs = append(filterArgs, q.Need)
+    linked := fmt.Sprintf("id IN (SELECT resource_id FROM resource_needs WHERE need_id = $%d)", len(filterArgs))
+
+    if filter == "" {
+      filter = linked
+    } else {
+      filter = "(" + filter + ") AND " + linked
+    }
+  }
+
+  conditions := []string{liveness(q.Deleted), filter}
+  args := filterArgs
+
+  sort := q.Sort.orDefault()
+  backward := q.Cursor != nil && q.Cursor.Backward
+
+  if q.Cursor.after() || q.Cursor.before() {
+    var keyset string
+    keyset, args = sort.keyset(q.Cursor.Key, backward, args)
+    conditions = append(conditions, keyset)
+  }
+
+  query := "SELECT " + resourceColumns + " FROM resources" + where(conditions) +
+    sort.orderBy(backward) + fmt.Sprintf(" LIMIT %d", q.Limit + 1)
+
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_cursor": q.Cursor,
+    "parameter_filter": q.Filter,
+    "parameter_need": q.Need,
+    "parameter_sort": sort.String(),
+    "parameter_limit": q.Limit,
+  }).Debug(query)
+
+  rows, err := s.DB.Query(query, args...)
+  if err != nil {
+    return Page{}, err
+  }
+
+  resources, err := scanResources(rows)
+  if err != nil {
+    return Page{}, err
+  }
+
+  page := newPage(q, resources)
+
+  if q.IncludeTotal {
+    var total int
+
+    query := "SELECT count(*) FROM resources" + where([]string{liveness(q.Deleted), filter})
+
+    if err := s.DB.QueryRow(query, filterArgs...).Scan(&total); err != nil {
+      return Page{}, err
+    }
+    page.Total = &total
+  }
+
+  return page, nil
+}
+
+// where joins the non-empty conditions into a WHERE clause
+func where(conditions []string) string {
+  var nonEmpty []string
+
+  for _, c := range conditions {
+    if c != "" {
+      nonEmpty = append(nonEmpty, c)
+    }
+  }
+
+  if len(nonEmpty) == 0 {
+    return ""
+  }
+
+  return " WHERE " + strings.Join(nonEmpty, " AND ")
+}
+
+const searchQuery = `
+  SELECT ` + resourceColumns + `,
+    ts_rank(search_vector, query) AS rank,
+    ts_headline('french_unaccent', description, query,
+      'StartSel=` + highlightStartSentinel + `, StopSel=` + highlightStopSentinel + `, HighlightAll=true') AS snippet
+  FROM resources, plainto_tsquery('french_unaccent', $1) query
+  WHERE search_vector @@ query AND deleted_at IS NULL
+  ORDER BY rank DESC, id
+  LIMIT $2
+  `
+
+func (s *PostgresStore) SearchResources(query string, limit int) ([]SearchResult, error) {
+  if len(searchTerms(query)) == 0 {
+    return nil, ErrEmptySearch
+  }
+
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+    "parameter_query": query,
+    "parameter_limit": limit,
+  }).Debug("SELECT ... FROM resources WHERE search_vector @@ plainto_tsquery('french_unaccent', {query})")
+
+  rows, err := s.DB.Query(searchQuery, query, limit)
+  if err != nil {
+    return nil, err
+  }
+
+  defer rows.Close()
+
+  results := []SearchResult{}
+
+  for rows.Next() {
+    var r SearchResult
+    if err := rows.Scan(append(r.columns(), &r.Rank, &r.Snippet)...); err != nil {
+      return nil, err
+    }
+    r.Snippet = highlight(r.Snippet)
+    results = append(results, r)
+  }
+
+  return results, rows.Err()
+}
+
+func scanResources(rows *sql.Rows) ([]Resource, error) {
+  defer rows.Close()
+
+  resources := []Resource{}
+
+  for rows.Next() {
+    var r Resource
+    if err := rows.Scan(r.columns()...); err != nil {
+      return nil, err
+    }
+    resources = append(resources, r)
+  }
+
+  return resources, rows.Err()
+}
+
+func (s *PostgresStore) CountResources() (int, error) {
+  postgresLog.WithFields(log.Fields{
+    "type": "database query",
+  }).Debug("SELECT count(*) FROM resources WHERE deleted_at IS NULL")
+
+  var count int
+  err := s.DB.QueryRow("SELECT count(*) FROM resources WHERE deleted_at IS NULL").Scan(&count)
+
+  return count, err
+}
@@ -0,0 +1,181 @@
+package resource
+
+import (
+	context "context"
+	sql     "database/sql"
+	os      "os"
+	_       "github.com/lib/pq"
+	sort    "sort"
+	strings "strings"
+	testing "testing"
+)
+
+// testDatabaseVariable names the URL of a PostgreSQL database the tests may
+// wipe; the tests needing one are skipped without it. The packages sharing it
+// must run one at a time, with go test -p 1.
+const testDatabaseVariable = "NEEDYS_API_RESOURCE_TEST_DATABASE_URL"
+
+// testStore returns a store on the test database, migrated and holding the
+// seeds only
+func testStore(t *testing.T) *PostgresStore {
+	url := os.Getenv(testDatabaseVariable)
+	if url == "" {
+		t.Skip(testDatabaseVariable + " is not set")
+	}
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("could not open the test database: %s", err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	s := NewPostgresStore(db)
+
+	if err = s.Initialize(); err != nil {
+		t.Fatalf("could not initialize the test database: %s", err)
+	}
+
+	return s
+}
+
+func createResources(t *testing.T, s *PostgresStore, descriptions ...string) []int {
+	var ids []int
+
+	for _, description := range descriptions {
+		r := Resource{Type: "individual", Description: description}
+
+		if err := s.CreateResource(context.Background(), &r); err != nil {
+			t.Fatalf("could not create the resource %q: %s", description, err)
+		}
+
+		ids = append(ids, r.ID)
+	}
+
+	return ids
+}
+
+func searchIDs(results []SearchResult) []int {
+	ids := []int{}
+
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+
+	return ids
+}
+
+func TestSearchResourcesIgnoresAccentsAndInflections(t *testing.T) {
+	s := testStore(t)
+	ids := createResources(t, s, "des ateliers de méditation à l'école", "une sieste au soleil")
+
+	tests := []struct {
+		query    string
+		expected []int
+	}{
+		{"meditation", []int{ids[0]}},
+		{"MÉDITATION", []int{ids[0]}},
+		{"atelier", []int{ids[0]}},
+		{"ecoles", []int{ids[0]}},
+		{"siestes", []int{1, ids[1]}},
+		{"piscine", []int{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			results, err := s.SearchResources(test.query, 10)
+			if err != nil {
+				t.Fatalf("could not search the resources: %s", err)
+			}
+
+			actual := searchIDs(results)
+			sort.Ints(actual)
+
+			if !equalIDs(actual, test.expected) {
+				t.Errorf("expected the search to find: %v, but actual is: %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSearchResourcesRanksTheBestMatchesFirst(t *testing.T) {
+	s := testStore(t)
+	ids := createResources(t, s,
+		"un jardin partagé",
+		"un jardin partagé, le jardin des voisins et leur jardin d'hiver")
+
+	results, err := s.SearchResources("jardin", 10)
+	if err != nil {
+		t.Fatalf("could not search the resources: %s", err)
+	}
+
+	if actual := searchIDs(results); !equalIDs(actual, []int{ids[1], ids[0]}) {
+		t.Fatalf("expected the resource naming the garden most to come first, but actual is: %v", actual)
+	}
+
+	if results[0].Rank <= results[1].Rank {
+		t.Errorf("expected the ranks to decrease, but actual are: %v and %v", results[0].Rank, results[1].Rank)
+	}
+}
+
+func TestSearchResourcesHighlightsAnEscapedSnippet(t *testing.T) {
+	s := testStore(t)
+	createResources(t, s, "une <b>sieste</b> & un café")
+
+	results, err := s.SearchResources("sieste", 10)
+	if err != nil {
+		t.Fatalf("could not search the resources: %s", err)
+	}
+
+	for _, r := range results {
+		if !strings.Contains(r.Description, "<b>") {
+			continue
+		}
+
+		for _, expected := range []string{"<mark>sieste</mark>", "&lt;b&gt;", "&amp;"} {
+			if !strings.Contains(r.Snippet, expected) {
+				t.Errorf("expected the snippet to contain: %s, but actual is: %s", expected, r.Snippet)
+			}
+		}
+
+		if strings.Contains(r.Snippet, "<b>") {
+			t.Errorf("expected the snippet to be escaped, but actual is: %s", r.Snippet)
+		}
+
+		return
+	}
+
+	t.Fatalf("expected the search to find the resource, but actual is: %v", searchIDs(results))
+}
+
+func TestSearchResourcesSkipsTheTrash(t *testing.T) {
+	s := testStore(t)
+	ids := createResources(t, s, "un atelier de méditation")
+
+	if err := s.DeleteResource(context.Background(), &Resource{ID: ids[0]}); err != nil {
+		t.Fatalf("could not delete the resource: %s", err)
+	}
+
+	results, err := s.SearchResources("meditation", 10)
+	if err != nil {
+		t.Fatalf("could not search the resources: %s", err)
+	}
+
+	if len(results) != 0 {
+		t.Errorf("expected the search to skip the trash, but actual is: %v", searchIDs(results))
+	}
+}
+
+func equalIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
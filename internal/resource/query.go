@@ -0,0 +1,159 @@
+package resource
+
+import (
+  base64 "encoding/base64"
+  bytes  "bytes"
+  errors "errors"
+  json   "encoding/json"
+)
+
+// Query describes one page of a resources listing
+type Query struct {
+  Limit  int
+  // Cursor is nil for the first page
+  Cursor *Cursor
+  // IncludeTotal counts every resource matching the query in Page.Total
+  IncludeTotal bool
+  Filter       Filter
+  // Sort defaults to DefaultSort when empty
+  Sort         Sort
+  // Deleted lists the trash instead of the live resources
+  Deleted      bool
+  // Need, unless 0, lists the resources answering this need only
+  Need         int
+}
+
+// Page is one page of resources, with the opaque cursors of its neighbours
+type Page struct {
+  Items      []Resource `json:"items"`
+  NextCursor string     `json:"next_cursor,omitempty"`
+  PrevCursor string     `json:"prev_cursor,omitempty"`
+  HasMore    bool       `json:"has_more"`
+  Total      *int       `json:"total,omitempty"`
+}
+
+// Cursor is the position of a page boundary: a page starts right after Key,
+// the sort values of a resource, or ends right before it when Backward is
+// set; Last points to the last page
+type Cursor struct {
+  Key      []interface{} `json:"key,omitempty"`
+  // Sort is the sort the key was taken with, a cursor is only valid for it
+  Sort     string        `json:"sort,omitempty"`
+  Backward bool          `json:"backward,omitempty"`
+  Last     bool          `json:"last,omitempty"`
+}
+
+// LastCursor points to the last page of a listing, whatever its sort
+var LastCursor = Cursor{Backward: true, Last: true}
+
+// after reports whether a page starts after a key, rather than at the start
+// or at the end of the listing
+func (c *Cursor) after() bool {
+  return c != nil && !c.Backward
+}
+
+// before reports whether a page ends before a key
+func (c *Cursor) before() bool {
+  return c != nil && c.Backward && !c.Last
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+func (c Cursor) Encode() string {
+  content, _ := json.Marshal(c)
+  return base64.RawURLEncoding.EncodeToString(content)
+}
+
+// DecodeCursor decodes a cursor produced by a listing with the same sort
+func DecodeCursor(encoded string, sort Sort) (*Cursor, error) {
+  content, err := base64.RawURLEncoding.DecodeString(encoded)
+  if err != nil {
+    return nil, ErrInvalidCursor
+  }
+
+  var c Cursor
+
+  decoder := json.NewDecoder(bytes.NewReader(content))
+  decoder.UseNumber()
+
+  if err = decoder.Decode(&c); err != nil {
+    return nil, ErrInvalidCursor
+  }
+
+  // the last cursor carries no key, anything else would be taken for one
+  if c.Last {
+    if !c.Backward || len(c.Key) > 0 {
+      return nil, ErrInvalidCursor
+    }
+
+    last := LastCursor
+    return &last, nil
+  }
+
+  if c.Sort != sort.orDefault().String() || len(c.Key) != len(sort.orDefault()) {
+    return nil, ErrInvalidCursor
+  }
+
+  for i, s := range sort.orDefault() {
+    if c.Key[i], err = fields[s.Field].fromJSON(c.Key[i]); err != nil {
+      return nil, ErrInvalidCursor
+    }
+  }
+
+  return &c, nil
+}
+
+// newPage builds a page from the resources fetched in the direction of the
+// query, ordered from the cursor onwards; one resource more than the limit
+// is expected when there is something beyond the page
+func newPage(q Query, resources []Resource) Page {
+  backward := q.Cursor != nil && q.Cursor.Backward
+  more := len(resources) > q.Limit
+
+  if more {
+    resources = resources[:q.Limit]
+  }
+
+  if backward {
+    for i, j := 0, len(resources) - 1; i < j; i, j = i + 1, j - 1 {
+      resources[i], resources[j] = resources[j], resources[i]
+    }
+  }
+
+  page := Page{Items: resources}
+
+  if len(resources) == 0 {
+    return page
+  }
+
+  sort := q.Sort.orDefault()
+
+  cursor := func(r Resource, backward bool) string {
+    return Cursor{Key: sort.key(r), Sort: sort.String(), Backward: backward}.Encode()
+  }
+
+  first := resources[0]
+  last := resources[len(resources) - 1]
+
+  if backward {
+    if !q.Cursor.Last {
+      page.NextCursor = cursor(last, false)
+    }
+
+    if more {
+      page.PrevCursor = cursor(first, true)
+    }
+  } else {
+    if more {
+      page.NextCursor = cursor(last, false)
+    }
+
+    if q.Cursor != nil {
+      page.PrevCursor = cursor(first, true)
+    }
+  }
+
+  page.HasMore = page.NextCursor != ""
+
+  return page
+}
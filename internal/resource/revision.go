@@ -0,0 +1,90 @@
+package resource
+
+import (
+  time "time"
+)
+
+// Operations recorded in the revisions of a resource
+const (
+  RevisionCreated  = "created"
+  RevisionUpdated  = "updated"
+  RevisionDeleted  = "deleted"
+  RevisionRestored = "restored"
+  RevisionReverted = "reverted"
+  // RevisionImported is the first revision of the resources which existed
+  // before their history was recorded
+  RevisionImported = "imported"
+)
+
+// Revision is the state of a resource after one of its changes; Revision is
+// the version of the resource the change produced
+type Revision struct {
+  ResourceID int       `json:"resource_id"`
+  Revision   int       `json:"revision"`
+  Operation  string    `json:"operation"`
+  Actor      string    `json:"actor"`
+  CreatedAt  time.Time `json:"created_at"`
+  Resource   Resource  `json:"resource"`
+  // Changes are the differences with the previous revision
+  Changes    []Change  `json:"changes"`
+}
+
+// Change is the difference of a field between two revisions
+type Change struct {
+  Field string      `json:"field"`
+  From  interface{} `json:"from"`
+  To    interface{} `json:"to"`
+}
+
+func newRevision(r Resource, operation string) Revision {
+  return Revision{
+    ResourceID: r.ID,
+    Revision: r.Version,
+    Operation: operation,
+    Actor: r.UpdatedBy,
+    CreatedAt: r.UpdatedAt,
+    Resource: r,
+  }
+}
+
+// Diff lists the fields a client sees change between two states of a
+// resource
+func Diff(before, after Resource) []Change {
+  changes := []Change{}
+
+  if before.Type != after.Type {
+    changes = append(changes, Change{"type", before.Type, after.Type})
+  }
+
+  if before.Description != after.Description {
+    changes = append(changes, Change{"description", before.Description, after.Description})
+  }
+
+  if !sameNeeds(normalizeNeeds(before.Needs), normalizeNeeds(after.Needs)) {
+    changes = append(changes, Change{"needs", normalizeNeeds(before.Needs), normalizeNeeds(after.Needs)})
+  }
+
+  if (before.DeletedAt == nil) != (after.DeletedAt == nil) {
+    changes = append(changes, Change{"deleted_at", before.DeletedAt, after.DeletedAt})
+  }
+
+  return changes
+}
+
+// chain sets the changes of revisions, given oldest first, each compared to
+// the previous one; the first is compared to previous, which may be empty
+func chain(previous Resource, revisions []Revision) {
+  for i := range revisions {
+    revisions[i].Changes = Diff(previous, revisions[i].Resource)
+    previous = revisions[i].Resource
+  }
+}
+
+// reverse orders revisions the other way round, e.g. newest first
+func reverse(revisions []Revision) []Revision {
+  for i, j := 0, len(revisions) - 1; i < j; i, j = i + 1, j - 1 {
+    revisions[i], revisions[j] = revisions[j], revisions[i]
+  }
+
+  return revisions
+}
@@ -0,0 +1,131 @@
+package resource
+
+import (
+  errors  "errors"
+  html    "html"
+  strings "strings"
+  unicode "unicode"
+)
+
+// SearchResult is a resource matching a full-text search, with its relevance
+// and its description, escaped as HTML, where the matching words are
+// highlighted
+type SearchResult struct {
+  Resource
+  Rank    float64 `json:"rank"`
+  Snippet string  `json:"snippet"`
+}
+
+const (
+  highlightStart = "<mark>"
+  highlightStop  = "</mark>"
+)
+
+// the database highlights with characters of the private use area, replaced
+// by the highlight tags once the snippet is escaped
+const (
+  highlightStartSentinel = "\uE000"
+  highlightStopSentinel  = "\uE001"
+)
+
+var highlights = strings.NewReplacer(
+  highlightStartSentinel, highlightStart,
+  highlightStopSentinel, highlightStop,
+)
+
+// highlight escapes a snippet highlighted with the sentinels as HTML
+func highlight(snippet string) string {
+  return highlights.Replace(html.EscapeString(snippet))
+}
+
+var ErrEmptySearch = errors.New("the search terms are empty")
+
+var accents = strings.NewReplacer(
+  "à", "a", "â", "a", "ä", "a", "á", "a", "ã", "a",
+  "ç", "c",
+  "é", "e", "è", "e", "ê", "e", "ë", "e",
+  "î", "i", "ï", "i", "í", "i", "ì", "i",
+  "ô", "o", "ö", "o", "ó", "o", "ò", "o", "õ", "o",
+  "ù", "u", "û", "u", "ü", "u", "ú", "u",
+  "ÿ", "y", "ñ", "n", "œ", "oe", "æ", "ae",
+)
+
+// normalizeWord lowers and unaccents a word, as the french_unaccent text
+// search configuration does before stemming
+func normalizeWord(word string) string {
+  return accents.Replace(strings.ToLower(word))
+}
+
+func isWordRune(r rune) bool {
+  return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+func splitWords(text string) []string {
+  return strings.FieldsFunc(text, func(r rune) bool { return !isWordRune(r) })
+}
+
+// searchTerms returns the normalized words of a search query
+func searchTerms(query string) []string {
+  var terms []string
+
+  for _, word := range splitWords(query) {
+    terms = append(terms, normalizeWord(word))
+  }
+
+  return terms
+}
+
+// matchSearch approximates the Postgres search without stemming: every term
+// must prefix a word of the description, the rank is the share of matching
+// words and these words are highlighted in the snippet
+func matchSearch(r Resource, terms []string) (SearchResult, bool) {
+  var snippet strings.Builder
+
+  matched := make(map[string]bool)
+  hits, words := 0, 0
+  runes := []rune(r.Description)
+
+  for i := 0; i < len(runes); {
+    if !isWordRune(runes[i]) {
+      snippet.WriteString(html.EscapeString(string(runes[i])))
+      i++
+
+      continue
+    }
+
+    start := i
+    for i < len(runes) && isWordRune(runes[i]) {
+      i++
+    }
+
+    word := string(runes[start:i])
+    normalized := normalizeWord(word)
+    hit := false
+
+    for _, term := range terms {
+      if strings.HasPrefix(normalized, term) {
+        matched[term] = true
+        hit = true
+      }
+    }
+
+    words++
+
+    if hit {
+      hits++
+      snippet.WriteString(highlightStart + word + highlightStop)
+    } else {
+      snippet.WriteString(word)
+    }
+  }
+
+  if len(terms) == 0 || len(matched) != len(terms) {
+    return SearchResult{}, false
+  }
+
+  return SearchResult{
+    Resource: r,
+    Rank: float64(hits) / float64(words),
+    Snippet: snippet.String(),
+  }, true
+}
@@ -0,0 +1,148 @@
+package resource
+
+import (
+  fmt     "fmt"
+  strings "strings"
+)
+
+// SortField orders a listing by a field, ascending unless Descending
+type SortField struct {
+  Field      string
+  Descending bool
+}
+
+// Sort orders a listing by several fields; it always ends with id so that
+// every resource has a distinct position and pages are stable
+type Sort []SortField
+
+var DefaultSort = Sort{{Field: "id"}}
+
+// SortError reports an invalid sort parameter
+type SortError struct {
+  Message string
+}
+
+func (e *SortError) Error() string {
+  return "invalid sort: " + e.Message
+}
+
+// ParseSort parses a comma-separated list of fields, each prefixed with "-"
+// for a descending order, e.g. "type,-id"
+func ParseSort(parameter string) (Sort, error) {
+  sort := Sort{}
+  seen := make(map[string]bool)
+
+  for _, item := range strings.Split(parameter, ",") {
+    item = strings.TrimSpace(item)
+
+    s := SortField{Field: strings.TrimPrefix(item, "-"), Descending: strings.HasPrefix(item, "-")}
+
+    if f, found := fields[s.Field]; !found || !f.sortable {
+      return nil, &SortError{Message: fmt.Sprintf("cannot sort on field %q", s.Field)}
+    }
+
+    if seen[s.Field] {
+      return nil, &SortError{Message: fmt.Sprintf("field %q is sorted twice", s.Field)}
+    }
+
+    seen[s.Field] = true
+    sort = append(sort, s)
+  }
+
+  if !seen["id"] {
+    sort = append(sort, SortField{Field: "id"})
+  }
+
+  return sort, nil
+}
+
+func (s Sort) orDefault() Sort {
+  if len(s) == 0 {
+    return DefaultSort
+  }
+
+  return s
+}
+
+func (s Sort) String() string {
+  var items []string
+
+  for _, f := range s {
+    if f.Descending {
+      items = append(items, "-" + f.Field)
+    } else {
+      items = append(items, f.Field)
+    }
+  }
+
+  return strings.Join(items, ",")
+}
+
+// key returns the values of the sort fields of a resource
+func (s Sort) key(r Resource) []interface{} {
+  key := make([]interface{}, len(s))
+
+  for i, f := range s {
+    key[i] = fields[f.Field].value(r)
+  }
+
+  return key
+}
+
+// compareKeys orders two keys according to the sort directions
+func (s Sort) compareKeys(a, b []interface{}) int {
+  for i, f := range s {
+    if result := compare(a[i], b[i]); result != 0 {
+      if f.Descending {
+        return -result
+      }
+      return result
+    }
+  }
+
+  return 0
+}
+
+// orderBy returns the SQL ORDER BY clause, reversed for backward pages
+func (s Sort) orderBy(reverse bool) string {
+  var items []string
+
+  for _, f := range s {
+    direction := "ASC"
+    if f.Descending != reverse {
+      direction = "DESC"
+    }
+    items = append(items, fields[f.Field].column + " " + direction)
+  }
+
+  return " ORDER BY " + strings.Join(items, ", ")
+}
+
+// keyset returns the SQL condition selecting the rows after the key in the
+// sort order, or before it when backward, and the args completed with the
+// key values; with a sort a,-b it is: a > $1 OR (a = $1 AND b < $2)
+func (s Sort) keyset(key []interface{}, backward bool, args []interface{}) (string, []interface{}) {
+  var alternatives []string
+  var placeholders []string
+
+  for i, f := range s {
+    args = append(args, key[i])
+    placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+
+    operator := ">"
+    if f.Descending != backward {
+      operator = "<"
+    }
+
+    var terms []string
+
+    for j := 0; j < i; j++ {
+      terms = append(terms, fmt.Sprintf("%s = %s", fields[s[j].Field].column, placeholders[j]))
+    }
+
+    terms = append(terms, fmt.Sprintf("%s %s %s", fields[f.Field].column, operator, placeholders[i]))
+    alternatives = append(alternatives, "(" + strings.Join(terms, " AND ") + ")")
+  }
+
+  return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
@@ -0,0 +1,258 @@
+package resource
+
+import (
+  bytes   "bytes"
+  errors  "errors"
+  fmt     "fmt"
+  io      "io"
+  ioutil  "io/ioutil"
+  json    "encoding/json"
+  reflect "reflect"
+  sort    "sort"
+  strings "strings"
+  time    "time"
+  utf8    "unicode/utf8"
+)
+
+// AllowedTypes are the values accepted for Resource.Type
+var AllowedTypes = []string{"individual", "collective"}
+
+const (
+  MaxTypeLength        = 64
+  MaxDescriptionLength = 1000
+  MaxNeeds             = 100
+)
+
+// FieldError is a problem on one field of a payload
+type FieldError struct {
+  Field   string `json:"field"`
+  Message string `json:"message"`
+}
+
+// ValidationError lists every problem found on a payload
+type ValidationError struct {
+  Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+  var messages []string
+
+  for _, f := range e.Errors {
+    messages = append(messages, f.Field + ": " + f.Message)
+  }
+
+  return "invalid resource: " + strings.Join(messages, "; ")
+}
+
+// ErrMalformedPayload is returned when a payload is not a single JSON object
+var ErrMalformedPayload = errors.New("malformed payload")
+
+// readOnlyFields are managed by the store, a client never sets them
+var readOnlyFields = []string{"id", "version", "created_at", "updated_at", "created_by", "updated_by", "deleted_at"}
+
+// DecodePayload reads and validates the resource a client sends to create or
+// replace one, rejecting the read-only fields as a patch changing them is;
+// every problem is reported in one *ValidationError
+func DecodePayload(reader io.Reader) (Resource, error) {
+  content, err := ioutil.ReadAll(reader)
+  if err != nil {
+    return Resource{}, err
+  }
+
+  r, members, problems, err := decode(content)
+  if err != nil {
+    return r, err
+  }
+
+  for _, name := range readOnlyFields {
+    if _, found := members[name]; found {
+      problems = append(problems, FieldError{name, "is read-only"})
+    }
+  }
+
+  return r, validateDecoded(r, problems)
+}
+
+// DecodeResource reads a JSON resource, rejecting unknown fields and values
+// of the wrong type with a *ValidationError listing all of them; it does not
+// call Validate
+func DecodeResource(reader io.Reader) (Resource, error) {
+  content, err := ioutil.ReadAll(reader)
+  if err != nil {
+    return Resource{}, err
+  }
+
+  r, _, problems, err := decode(content)
+  if err != nil {
+    return r, err
+  }
+
+  if len(problems) > 0 {
+    return r, &ValidationError{Errors: problems}
+  }
+
+  return r, nil
+}
+
+// decode reads the members of a JSON object one by one into a resource, so
+// that every unknown member and every value of the wrong type is reported,
+// in the order of the member names; it fails with ErrMalformedPayload when
+// the content is not a single JSON object
+func decode(content []byte) (Resource, map[string]json.RawMessage, []FieldError, error) {
+  var r Resource
+  var members map[string]json.RawMessage
+
+  decoder := json.NewDecoder(bytes.NewReader(content))
+
+  // nothing may follow the object
+  if decoder.Decode(&members) != nil || members == nil || decoder.Decode(&struct{}{}) != io.EOF {
+    return r, nil, nil, ErrMalformedPayload
+  }
+
+  names := make([]string, 0, len(members))
+
+  for name := range members {
+    names = append(names, name)
+  }
+
+  sort.Strings(names)
+
+  var problems []FieldError
+  value := reflect.ValueOf(&r).Elem()
+
+  for _, name := range names {
+    field, found := fieldByName(value, name)
+    if !found {
+      problems = append(problems, FieldError{name, "is not a known field"})
+      continue
+    }
+
+    if err := json.Unmarshal(members[name], field.Addr().Interface()); err != nil {
+      problems = append(problems, FieldError{name, "must be " + jsonType(field.Type())})
+    }
+  }
+
+  return r, members, problems, nil
+}
+
+// fieldByName returns the field of a resource named name in JSON, matched
+// without regard to case as encoding/json does
+func fieldByName(v reflect.Value, name string) (reflect.Value, bool) {
+  t := v.Type()
+
+  for i := 0; i < t.NumField(); i++ {
+    tag := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+
+    if tag != "" && tag != "-" && strings.EqualFold(tag, name) {
+      return v.Field(i), true
+    }
+  }
+
+  return reflect.Value{}, false
+}
+
+// validateDecoded adds the problems Validate finds on the fields which could
+// be decoded to the problems of decoding, if any
+func validateDecoded(r Resource, problems []FieldError) error {
+  reported := problems
+  var validation *ValidationError
+
+  if errors.As(r.Validate(), &validation) {
+    for _, p := range validation.Errors {
+      if !reportedField(reported, p.Field) {
+        problems = append(problems, p)
+      }
+    }
+  }
+
+  if len(problems) > 0 {
+    return &ValidationError{Errors: problems}
+  }
+
+  return nil
+}
+
+// reportedField tells whether one of problems is on field
+func reportedField(problems []FieldError, field string) bool {
+  for _, p := range problems {
+    if p.Field == field {
+      return true
+    }
+  }
+
+  return false
+}
+
+// jsonType names the JSON type a Go type is decoded from
+func jsonType(t reflect.Type) string {
+  if t == reflect.TypeOf(time.Time{}) || t == reflect.TypeOf(&time.Time{}) {
+    return "an RFC 3339 date"
+  }
+
+  switch t.Kind() {
+  case reflect.String:
+    return "a string"
+  case reflect.Bool:
+    return "a boolean"
+  case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+    reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+    return "an integer"
+  case reflect.Float32, reflect.Float64:
+    return "a number"
+  case reflect.Slice, reflect.Array:
+    return "an array"
+  default:
+    return "an object"
+  }
+}
+
+// Validate checks the fields a client may set
+func (r *Resource) Validate() error {
+  var problems []FieldError
+
+  if strings.TrimSpace(r.Type) == "" {
+    problems = append(problems, FieldError{"type", "is required"})
+  } else if utf8.RuneCountInString(r.Type) > MaxTypeLength {
+    problems = append(problems, FieldError{"type", fmt.Sprintf("must be at most %d characters", MaxTypeLength)})
+  } else if !isAllowedType(r.Type) {
+    problems = append(problems, FieldError{"type", "must be one of " + strings.Join(AllowedTypes, ", ")})
+  }
+
+  if strings.TrimSpace(r.Description) == "" {
+    problems = append(problems, FieldError{"description", "is required"})
+  } else if utf8.RuneCountInString(r.Description) > MaxDescriptionLength {
+    problems = append(problems,
+      FieldError{"description", fmt.Sprintf("must be at most %d characters", MaxDescriptionLength)})
+  }
+
+  if len(r.Needs) > MaxNeeds {
+    problems = append(problems, FieldError{"needs", fmt.Sprintf("must hold at most %d needs", MaxNeeds)})
+  }
+
+  seen := make(map[int]bool)
+
+  for _, id := range r.Needs {
+    if id < 1 {
+      problems = append(problems, FieldError{"needs", fmt.Sprintf("%d is not a need ID", id)})
+    } else if seen[id] {
+      problems = append(problems, FieldError{"needs", fmt.Sprintf("need %d is given twice", id)})
+    }
+    seen[id] = true
+  }
+
+  if len(problems) > 0 {
+    return &ValidationError{Errors: problems}
+  }
+
+  return nil
+}
+
+func isAllowedType(t string) bool {
+  for _, allowed := range AllowedTypes {
+    if t == allowed {
+      return true
+    }
+  }
+
+  return false
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+  context "context"
+  log     "github.com/sirupsen/logrus"
+  time    "time"
+)
+
+var trashLog *log.Entry
+
+func init() {
+  trashLog = log.WithFields(log.Fields{
+    "_file": "internal/trash.go",
+    "_type": "system",
+  })
+}
+
+// purgeTrash removes for good, every purge interval, the resources deleted
+// for longer than the retention period, until the context is done
+func (a *Application) purgeTrash(ctx context.Context) {
+  if a.Config.Trash.RetentionDays == 0 {
+    trashLog.Info("the trash is never purged")
+    return
+  }
+
+  retention := time.Duration(a.Config.Trash.RetentionDays) * 24 * time.Hour
+
+  ticker := time.NewTicker(time.Duration(a.Config.Trash.PurgeInterval) * time.Second)
+  defer ticker.Stop()
+
+  for {
+    purged, err := a.Store.PurgeResources(time.Now().Add(-retention))
+
+    if err != nil {
+      trashLog.WithFields(log.Fields{
+        "error": err,
+      }).Error("could not purge the trash")
+    } else if purged > 0 {
+      trashLog.WithFields(log.Fields{
+        "purged": purged,
+      }).Info("purged the trash")
+    }
+
+    select {
+    case <-ctx.Done():
+      return
+    case <-ticker.C:
+    }
+  }
+}
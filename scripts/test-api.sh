@@ -49,9 +49,9 @@ fetch () {
 create () {
   echo "${COLOR_TEST}\nCREATE TEST\n-----------${COLOR_RESET}"
   if [ "${log_query}" = "true" ]; then
-    echo "DEBUG: curl -i -H \"Content-Type: application/json\" -d '{\"description\":\"faire une bonne sieste\", \"needId\":3}' -X POST http://localhost:8012/resource"
+    echo "DEBUG: curl -i -H \"Content-Type: application/json\" -d '{\"type\":\"individual\", \"description\":\"faire une bonne sieste\", \"needs\":[3]}' -X POST http://localhost:8012/resource"
   fi
-  curl -i -H "Content-Type: application/json" -d '{"description":"faire une bonne sieste", "needId":3}' -X POST http://localhost:8012/resource
+  curl -i -H "Content-Type: application/json" -d '{"type":"individual", "description":"faire une bonne sieste", "needs":[3]}' -X POST http://localhost:8012/resource
 }
 
 update () {